@@ -0,0 +1,88 @@
+package lexer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// EncodeTokens writes toks to w in a compact binary form so that tools can
+// cache a token stream without lexing again.  Each token is written as a
+// signed varint type, unsigned varints for the line and column of its start
+// and of its end, an unsigned varint value length, and the value bytes.
+func EncodeTokens(w io.Writer, toks []Token) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, tok := range toks {
+		n := binary.PutVarint(buf, int64(tok.Type))
+		bw.Write(buf[:n])
+		n = binary.PutUvarint(buf, uint64(tok.Line))
+		bw.Write(buf[:n])
+		n = binary.PutUvarint(buf, uint64(tok.Col))
+		bw.Write(buf[:n])
+		n = binary.PutUvarint(buf, uint64(tok.EndLine))
+		bw.Write(buf[:n])
+		n = binary.PutUvarint(buf, uint64(tok.EndCol))
+		bw.Write(buf[:n])
+		n = binary.PutUvarint(buf, uint64(len(tok.Value)))
+		bw.Write(buf[:n])
+		bw.WriteString(tok.Value)
+	}
+	return bw.Flush()
+}
+
+// DecodeTokens reads a token stream written by EncodeTokens.
+func DecodeTokens(r io.Reader) ([]Token, error) {
+	br := bufio.NewReader(r)
+	var toks []Token
+	for {
+		typ, err := binary.ReadVarint(br)
+		if err == io.EOF {
+			return toks, nil
+		} else if err != nil {
+			return toks, fmt.Errorf("token %d: bad type: %v", len(toks), err)
+		}
+		line, err := binary.ReadUvarint(br)
+		if err != nil {
+			return toks, fmt.Errorf("token %d: bad line: %v", len(toks), unexpected(err))
+		}
+		col, err := binary.ReadUvarint(br)
+		if err != nil {
+			return toks, fmt.Errorf("token %d: bad column: %v", len(toks), unexpected(err))
+		}
+		endLine, err := binary.ReadUvarint(br)
+		if err != nil {
+			return toks, fmt.Errorf("token %d: bad end line: %v", len(toks), unexpected(err))
+		}
+		endCol, err := binary.ReadUvarint(br)
+		if err != nil {
+			return toks, fmt.Errorf("token %d: bad end column: %v", len(toks), unexpected(err))
+		}
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return toks, fmt.Errorf("token %d: bad length: %v", len(toks), unexpected(err))
+		}
+		if size > math.MaxInt64 {
+			return toks, fmt.Errorf("token %d: bad length: %d is out of range", len(toks), size)
+		}
+		// Copy rather than allocate size bytes up front, so that a corrupt
+		// length runs out of input instead of memory.
+		var value strings.Builder
+		if _, err := io.CopyN(&value, br, int64(size)); err != nil {
+			return toks, fmt.Errorf("token %d: bad value: %v", len(toks), unexpected(err))
+		}
+		toks = append(toks, Token{Type: TokenType(typ), Value: value.String(), Line: int(line), Col: int(col),
+			EndLine: int(endLine), EndCol: int(endCol)})
+	}
+}
+
+// unexpected reports a clean EOF inside a token as a truncated stream.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -30,6 +30,9 @@
 // 		...
 // 		tok := lex.NextToken()
 //
+// Or skip Start and call lex.NextTokenSync, which runs the states on the
+// calling goroutine as tokens are needed.
+//
 // Credits: this is a modified version of github.com/bbuck/go-lexer (MIT license).
 package lexer
 
@@ -45,23 +48,51 @@ import (
 // ErrorTok is used to send back errors to the parser.
 const ErrorTok = TokenType(-1)
 
+// WarningTok is used to send back warnings to the parser.  Unlike ErrorTok it
+// does not terminate the scan.
+const WarningTok = TokenType(-2)
+
 func init() {
 	TokenName[ErrorTok] = "ErrorTok"
+	TokenName[WarningTok] = "WarningTok"
 }
 
 const (
 	// EOFRune is pseudo-rune signaling the end of the input string
 	EOFRune rune = 0
+
+	// DefaultTabWidth is the distance between tab stops unless Lex.TabWidth
+	// sets another.
+	DefaultTabWidth = 4
 )
 
 // Lex encapsulates the lexer state.  State is for client use.
+//
+// OnEmit, if set, is called with every token just before it is sent to the
+// parser.  It is meant for tracing and must not call back into the lexer.
+//
+// MaxLexemeLength, if positive, limits the bytes a single token may span.
+// Scanning stops at the limit, the next token is replaced by an ErrorTok, and
+// the scan terminates.  This protects against runaway input such as a quote
+// that is never closed.
+//
+// TabWidth, if positive, is the distance between tab stops used for token
+// columns and by grammars that measure indentation.
 type Lex struct {
 	source          string
 	startState      StateFunc
 	start, position int
+	line, col       int // position of start
 	atEOF           bool
+	tooLong, halted bool
 	tokens          chan Token
+	sync            bool      // driven by NextTokenSync rather than Start
+	state           StateFunc // next state to run in sync mode
+	pending         []Token   // tokens emitted in sync mode but not yet read
 	State           interface{}
+	OnEmit          func(Token)
+	MaxLexemeLength int
+	TabWidth        int
 }
 
 // New returns a lexer ready to parse the given string.
@@ -71,6 +102,8 @@ func New(src string, startState StateFunc) *Lex {
 		startState: startState,
 		start:      0,
 		position:   0,
+		line:       1,
+		col:        1,
 	}
 }
 
@@ -80,7 +113,7 @@ func (l *Lex) Start() *Lex {
 	go func() {
 		defer close(l.tokens)
 		state := l.startState
-		for state != nil {
+		for state != nil && !l.halted {
 			state = state(l)
 		}
 	}()
@@ -95,6 +128,29 @@ func (l *Lex) NextToken() *Token {
 	return nil
 }
 
+// NextTokenSync is NextToken without the goroutine and channel of Start.  It
+// runs the state functions on the calling goroutine until a token has been
+// emitted, and returns it, or nil once the scan has finished.  The tokens are
+// the same as those of NextToken.  A lexer is driven either by Start and
+// NextToken or by NextTokenSync alone.
+func (l *Lex) NextTokenSync() *Token {
+	if l.tokens != nil {
+		panic("NextTokenSync called on a lexer running in a goroutine.")
+	}
+	if !l.sync {
+		l.sync, l.state = true, l.startState
+	}
+	for len(l.pending) == 0 && l.state != nil && !l.halted {
+		l.state = l.state(l)
+	}
+	if len(l.pending) == 0 {
+		return nil
+	}
+	tok := l.pending[0]
+	l.pending = l.pending[1:]
+	return &tok
+}
+
 /* ----------------------------------------------------------------------------------- */
 /* Scanner API */
 
@@ -121,28 +177,108 @@ func (l *Lex) Emit(t TokenType) {
 	tok := Token{
 		Type:  t,
 		Value: l.Current(),
+		Line:  l.line,
+		Col:   l.col,
 	}
 	l.Ignore()
-	l.tokens <- tok
+	tok.EndLine, tok.EndCol = l.line, l.col
+	l.send(tok)
+}
+
+// EmitValue pushes a token of type T with the given value instead of the
+// current one.  The current value is skipped as if it had been emitted.
+func (l *Lex) EmitValue(t TokenType, value string) {
+	tok := Token{
+		Type:  t,
+		Value: value,
+		Line:  l.line,
+		Col:   l.col,
+	}
+	l.Ignore()
+	tok.EndLine, tok.EndCol = l.line, l.col
+	l.send(tok)
 }
 
 // Errorf is a state function that formats an error message and returns it as
 // an ErrorTok token.  The scan terminates.
 func (l *Lex) Errorf(format string, args ...interface{}) StateFunc {
 	tok := Token{
-		ErrorTok,
-		fmt.Sprintf(format, args...),
+		Type:    ErrorTok,
+		Value:   fmt.Sprintf(format, args...),
+		Line:    l.line,
+		Col:     l.col,
+		EndLine: l.line,
+		EndCol:  l.col,
 	}
-	l.tokens <- tok
+	l.send(tok)
 	return nil
 }
 
+// Warnf formats a message and sends it as a WarningTok token.  The current
+// value is left in place so the caller can still emit it.
+func (l *Lex) Warnf(format string, args ...interface{}) {
+	l.send(Token{
+		Type:    WarningTok,
+		Value:   fmt.Sprintf(format, args...),
+		Line:    l.line,
+		Col:     l.col,
+		EndLine: l.line,
+		EndCol:  l.col,
+	})
+}
+
+// send reports tok to the OnEmit hook and then hands it to the parser.  Once
+// the lexeme limit has been hit only the limit error is sent.
+func (l *Lex) send(tok Token) {
+	if l.halted {
+		return
+	}
+	if l.tooLong {
+		tok.Type = ErrorTok
+		tok.Value = fmt.Sprintf("Lexeme exceeds the maximum length of %d bytes.", l.MaxLexemeLength)
+		l.halted = true
+	}
+	if l.OnEmit != nil {
+		l.OnEmit(tok)
+	}
+	if l.sync {
+		l.pending = append(l.pending, tok)
+		return
+	}
+	l.tokens <- tok
+}
+
 // Ignore skips over the current string to ignore the section of the source
-// being analyzed.
+// being analyzed.  The line and column of the next token move past it.  A
+// \r\n and a lone \r end a line just as \n does.
 func (l *Lex) Ignore() {
+	for i, r := range l.source[l.start:l.position] {
+		switch r {
+		case '\n':
+			if i := l.start + i; i > 0 && l.source[i-1] == '\r' {
+				break // the second half of \r\n
+			}
+			l.line, l.col = l.line+1, 1
+		case '\r':
+			l.line, l.col = l.line+1, 1
+		case '\t':
+			l.col += l.TabSize() - (l.col-1)%l.TabSize()
+		default:
+			l.col++
+		}
+	}
 	l.start = l.position
 }
 
+// TabSize returns the distance between tab stops: TabWidth if it is set and
+// DefaultTabWidth otherwise.
+func (l *Lex) TabSize() int {
+	if l.TabWidth > 0 {
+		return l.TabWidth
+	}
+	return DefaultTabWidth
+}
+
 // Peek performs a Next operation immediately followed by a Backup returning the
 // peeked rune.
 func (l *Lex) Peek() rune {
@@ -159,6 +295,10 @@ func (l *Lex) Next() rune {
 		r rune
 		s int
 	)
+	if l.MaxLexemeLength > 0 && l.position-l.start > l.MaxLexemeLength {
+		l.tooLong, l.atEOF = true, true // stop scanning as if at the end
+		return EOFRune
+	}
 	str := l.source[l.position:]
 	if len(str) == 0 {
 		if l.atEOF {
@@ -202,14 +342,19 @@ func (l *Lex) AcceptRun(chars string) {
 	l.Backup()
 }
 
-// AcceptTo accepts runes not found in CHARS or the line ends.
+// AcceptTo accepts runes not found in CHARS or the line ends, \n or \r.
 func (l *Lex) AcceptTo(chars string) {
-	chars = chars + "\n\x00"
+	chars = chars + "\n\r\x00"
 	for !strings.ContainsRune(chars, l.Next()) {
 	}
 	l.Backup()
 }
 
+// AtEnd returns true if the whole source has been consumed.
+func (l *Lex) AtEnd() bool {
+	return l.position >= len(l.source)
+}
+
 // LookingAt returns true if the current position starts with PREFIX.
 func (l *Lex) LookingAt(prefix string) bool {
 	if strings.HasPrefix(l.source[l.position:], prefix) {
@@ -158,8 +158,138 @@ func Test_LexerError(t *testing.T) {
 	l := lexer.New("1", WhitespaceState)
 	l.Start()
 
-	tok := lexer.Token{lexer.ErrorTok, "unexpected token '1'"}
-	if got, expect := *l.NextToken(), tok; got != expect {
+	tok := lexer.Token{Type: lexer.ErrorTok, Value: "unexpected token '1'"}
+	if got, expect := *l.NextToken(), tok; got.Type != expect.Type || got.Value != expect.Value {
 		t.Errorf("Expected %v but got %v", expect, got)
 	}
 }
+
+const (
+	plusToken lexer.TokenType = iota + 10
+	parenToken
+)
+
+func Test_SingleCharState(t *testing.T) {
+	chars := lexer.SingleChars{}.Register("+-", plusToken).Register("()", parenToken)
+	var state lexer.StateFunc
+	state = func(l *lexer.Lex) lexer.StateFunc {
+		if l.Peek() == lexer.EOFRune {
+			return nil
+		}
+		if _, ok := chars.Lookup(l.Peek()); ok {
+			return lexer.SingleCharState(chars, state)
+		}
+		l.AcceptRun("0123456789")
+		l.Emit(NumberToken)
+		return state
+	}
+
+	cases := []lexer.Token{
+		{Type: parenToken, Value: "("},
+		{Type: NumberToken, Value: "1"},
+		{Type: plusToken, Value: "+"},
+		{Type: NumberToken, Value: "23"},
+		{Type: parenToken, Value: ")"},
+		{Type: plusToken, Value: "-"},
+	}
+	l := lexer.New("(1+23)-", state)
+	l.Start()
+	for _, c := range cases {
+		tok := l.NextToken()
+		if tok == nil || tok.Type != c.Type || tok.Value != c.Value {
+			t.Errorf("Expected %v but got %v", c, tok)
+			return
+		}
+	}
+	if tok := l.NextToken(); tok != nil {
+		t.Errorf("Did not expect a token, but got %v", *tok)
+	}
+}
+
+func Test_TokenTypeString(t *testing.T) {
+	testCases := []struct {
+		tt     lexer.TokenType
+		expect string
+	}{
+		{lexer.ErrorTok, "ErrorTok"},
+		{lexer.WarningTok, "WarningTok"},
+		{lexer.TokenType(4242), "tok4242"},
+		{lexer.TokenType(-7), "tokNeg7"},
+	}
+	for _, tC := range testCases {
+		if got := tC.tt.String(); got != tC.expect {
+			t.Errorf("Expected %s but got %s", tC.expect, got)
+		}
+	}
+}
+
+func Test_TokenPositions(t *testing.T) {
+	var words lexer.StateFunc
+	words = func(l *lexer.Lex) lexer.StateFunc {
+		l.AcceptRun(" \t\n")
+		l.Ignore()
+		if l.Peek() == lexer.EOFRune {
+			return nil
+		}
+		for r := l.Next(); r != ' ' && r != '\t' && r != '\n' && r != lexer.EOFRune; r = l.Next() {
+		}
+		l.Backup()
+		l.Emit(identifierToken)
+		return words
+	}
+
+	cases := []lexer.Token{
+		{Type: identifierToken, Value: "one", Line: 1, Col: 1, EndLine: 1, EndCol: 4},
+		{Type: identifierToken, Value: "héllo", Line: 1, Col: 5, EndLine: 1, EndCol: 10},
+		{Type: identifierToken, Value: "two", Line: 2, Col: 5, EndLine: 2, EndCol: 8},
+		{Type: identifierToken, Value: "x", Line: 3, Col: 3, EndLine: 3, EndCol: 4},
+		{Type: identifierToken, Value: "y", Line: 3, Col: 5, EndLine: 3, EndCol: 6},
+	}
+	l := lexer.New("one héllo\n\ttwo\n  x\ty", words)
+	l.Start()
+	for _, c := range cases {
+		if tok := l.NextToken(); tok == nil || *tok != c {
+			t.Errorf("Expected %v at %d:%d-%d:%d but got %+v", c, c.Line, c.Col, c.EndLine, c.EndCol, tok)
+		}
+	}
+}
+
+func Test_NextTokenSync(t *testing.T) {
+	for _, src := range []string{"123.hello 45.world", "1.a !", "123456.abc"} {
+		t.Run(src, func(t *testing.T) {
+			async := lexer.New(src, NumberState)
+			async.MaxLexemeLength = 5
+			async.Start()
+			sync := lexer.New(src, NumberState)
+			sync.MaxLexemeLength = 5
+			for {
+				want, got := async.NextToken(), sync.NextTokenSync()
+				if want == nil || got == nil {
+					if want != got {
+						t.Errorf("Expected %v, but found %v", want, got)
+					}
+					return
+				}
+				if *got != *want {
+					t.Errorf("Expected %v, but found %v", *want, *got)
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_NextToken(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		l := lexer.New("123.hello 45.world 6.x", NumberState).Start()
+		for l.NextToken() != nil {
+		}
+	}
+}
+
+func Benchmark_NextTokenSync(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		l := lexer.New("123.hello 45.world 6.x", NumberState)
+		for l.NextTokenSync() != nil {
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package lexer
+
+// SingleChars is a registry mapping runes to the token type each one emits
+// on its own, such as '(' or ','.  A grammar registers its punctuation once
+// instead of writing a case for every rune in its state functions.
+type SingleChars map[rune]TokenType
+
+// Register maps every rune in chars to the token type t and returns sc.
+func (sc SingleChars) Register(chars string, t TokenType) SingleChars {
+	for _, r := range chars {
+		sc[r] = t
+	}
+	return sc
+}
+
+// Lookup returns the token type registered for r.
+func (sc SingleChars) Lookup(r rune) (TokenType, bool) {
+	t, ok := sc[r]
+	return t, ok
+}
+
+// SingleCharState returns a state that consumes one rune, emits the token
+// registered for it, and continues with next.  A rune that is not registered
+// is left unread and the scan continues with next as well, so the state can
+// be tried ahead of a grammar's other states.
+func SingleCharState(sc SingleChars, next StateFunc) StateFunc {
+	return func(l *Lex) StateFunc {
+		r := l.Next()
+		if t, ok := sc.Lookup(r); ok && r != EOFRune {
+			l.Emit(t)
+		} else {
+			l.Backup()
+		}
+		return next
+	}
+}
@@ -15,21 +15,40 @@ import (
 // The lexer should scan the value, letting the parser do the validation.
 type TokenType int
 
+// String returns the registered name of tt.  ErrorTok and WarningTok always
+// have their own names; any other unregistered type is "tok" followed by its
+// number, or "tokNeg" and the magnitude for a negative type.
 func (tt TokenType) String() string {
 	if tokString, ok := TokenName[tt]; ok {
 		return tokString
 	}
-	return "tok_" + strconv.Itoa(int(tt))
+	switch {
+	case tt == ErrorTok:
+		return "ErrorTok"
+	case tt == WarningTok:
+		return "WarningTok"
+	case tt < 0:
+		return "tokNeg" + strconv.Itoa(-int(tt))
+	}
+	return "tok" + strconv.Itoa(int(tt))
 }
 
 // TokenName maps token values to strings.  Add const values defined in other packages.
 var TokenName = map[TokenType]string{}
 
 // Token represents a lexeme detected by the lexer.  It has a type and a value.
-// The value is always a slice of the input string.
+// The value is always a slice of the input string.  Line and Col give the
+// position where the lexeme starts, both counted from 1, and EndLine and
+// EndCol the position just past its end.  A tab advances the column to the
+// next tab stop (see Lex.TabSize), and a multi-byte rune counts as one
+// column.
 type Token struct {
-	Type  TokenType
-	Value string
+	Type    TokenType
+	Value   string
+	Line    int
+	Col     int
+	EndLine int
+	EndCol  int
 }
 
 func (t Token) String() string {
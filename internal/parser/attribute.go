@@ -1,13 +1,25 @@
 package parser
 
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
 // Attribute represents an attribute definition.
 // The types legal in a DTD are ID, IDREF, IDREFS, NMTOKEN, NMTOKENS,
 // ENTITY, ENTITIES, NOTATION, or an enumerated list of NMTOKEN.
 type Attribute struct {
-	Name    string // name of Attribute (future: qname)
-	Type    string // type of Attribute
-	Occur   Occur  // occurrence qualifier - default #IMPLIED
-	Default string // default value of attribute or empty
+	Name    string `json:"name"`              // name of Attribute, possibly a qname like xml:lang
+	Type    string `json:"type"`              // type of Attribute
+	Occur   Occur  `json:"occur,omitempty"`   // occurrence qualifier - default #IMPLIED
+	Default string `json:"default,omitempty"` // default value of attribute or empty
+	Target  string `json:"target,omitempty"`  // element an IDREF or IDREFS value refers to, if known
+
+	TypeInferred bool     `json:"typeInferred,omitempty"` // Type was derived from Name rather than written
+	DefPos       Position `json:"-"`                      // span of the definition in its source, if parsed
+
+	block int // the attribute list declaration of its element it came from, from 0
 }
 
 // Occur represents the occurrence qualifier of an attribute.
@@ -18,3 +30,244 @@ const (
 	required Occur = "#REQUIRED"
 	fixed    Occur = "#FIXED"
 )
+
+// Prefix returns the namespace prefix of the attribute name, or "" if the
+// name has none.
+func (a *Attribute) Prefix() string {
+	prefix, _ := splitQName(a.Name)
+	return prefix
+}
+
+// Local returns the attribute name without its namespace prefix.
+func (a *Attribute) Local() string {
+	_, local := splitQName(a.Name)
+	return local
+}
+
+// isOccur reports whether a directive is an occurrence qualifier rather
+// than a type.
+func isOccur(directive string) bool {
+	switch Occur(directive) {
+	case implied, required, fixed:
+		return true
+	}
+	return false
+}
+
+// atomicTypes are the attribute types legal in a DTD besides enumerations.
+var atomicTypes = map[string]bool{
+	"CDATA":    true,
+	"ID":       true,
+	"IDREF":    true,
+	"IDREFS":   true,
+	"ENTITY":   true,
+	"ENTITIES": true,
+	"NMTOKEN":  true,
+	"NMTOKENS": true,
+}
+
+// Validate checks that the attribute type and default are legal in a DTD.  A
+// directive type such as #ID must name one of the atomic types.  Members of
+// an enumeration must be NMTOKENs and members of a NOTATION enumeration must
+// be Names, and in both no member may repeat.  A #REQUIRED attribute may not
+// have a default and a #FIXED one must have it.  Neither may an #IMPLIED one:
+// the plain default form has no qualifier, and leaves Occur empty.  An ID
+// attribute is #IMPLIED or #REQUIRED, never #FIXED or with a default.  Only
+// an IDREF or IDREFS attribute may have a Target.
+func (a *Attribute) Validate() error {
+	switch {
+	case a.Occur == required && a.Default != "":
+		return fmt.Errorf("attribute %s: #REQUIRED attribute cannot have a default", a.Name)
+	case a.Occur == fixed && a.Default == "":
+		return fmt.Errorf("attribute %s: #FIXED attribute must have a default", a.Name)
+	case a.Occur == implied && a.Default != "":
+		return fmt.Errorf("attribute %s: #IMPLIED attribute cannot have a default", a.Name)
+	case isID(*a) && (a.Occur == fixed || a.Default != ""):
+		return fmt.Errorf("attribute %s: ID attribute must be #IMPLIED or #REQUIRED", a.Name)
+	case a.Target != "" && !isIDRef(*a):
+		return fmt.Errorf("attribute %s: only an IDREF or IDREFS attribute has a target", a.Name)
+	}
+
+	typ := strings.TrimPrefix(a.Type, "#")
+	switch {
+	case typ == "":
+		return fmt.Errorf("attribute %s has no type", a.Name)
+	case isNotation(typ):
+		return a.validateEnum(notationValues(typ), "notation", "Name", isName)
+	case isEnumeration(typ):
+		return a.validateEnum(enumValues(typ), "enumeration value", "NMTOKEN", isNmtoken)
+	case !atomicTypes[typ]:
+		return fmt.Errorf("attribute %s: illegal type %q", a.Name, a.Type)
+	}
+	return nil
+}
+
+// validateEnum checks that each of values is valid and unique.
+func (a *Attribute) validateEnum(values []string, kind, production string, valid func(string) bool) error {
+	seen := map[string]bool{}
+	for _, v := range values {
+		if !valid(v) {
+			return fmt.Errorf("attribute %s: %s %q is not a %s", a.Name, kind, v, production)
+		}
+		if seen[v] {
+			return fmt.Errorf("attribute %s: duplicate %s %q", a.Name, kind, v)
+		}
+		seen[v] = true
+	}
+	return nil
+}
+
+// ValidateAttrs validates each attribute of e and the rules that span the
+// whole attribute list: no two attributes share a name, and an element may
+// have at most one ID attribute and one NOTATION attribute.
+func (e *Element) ValidateAttrs() []error {
+	var errs []error
+	notation, id := "", ""
+	seen := map[string]bool{}
+	for i := range e.Attrs {
+		a := &e.Attrs[i]
+		if err := a.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("element %s: %v", e.Name, err))
+		}
+		if seen[a.Name] {
+			errs = append(errs, fmt.Errorf("element %s: duplicate attribute %s", e.Name, a.Name))
+		}
+		seen[a.Name] = true
+		if isID(*a) {
+			if id != "" {
+				errs = append(errs, fmt.Errorf("element %s: attribute %s: second ID attribute after %s", e.Name, a.Name, id))
+			} else {
+				id = a.Name
+			}
+		}
+		if isNotation(strings.TrimPrefix(a.Type, "#")) {
+			if notation != "" {
+				errs = append(errs, fmt.Errorf("element %s: attribute %s: second NOTATION attribute after %s", e.Name, a.Name, notation))
+			} else {
+				notation = a.Name
+			}
+		}
+	}
+	return errs
+}
+
+// AddAttribute appends a to the attributes of e.  It fails if a is not valid,
+// if e already has an attribute with the same name, or if a would be a
+// second ID attribute.
+func (e *Element) AddAttribute(a Attribute) error {
+	if err := a.Validate(); err != nil {
+		return fmt.Errorf("element %s: %v", e.Name, err)
+	}
+	for _, old := range e.Attrs {
+		if old.Name == a.Name {
+			return fmt.Errorf("element %s: duplicate attribute %s", e.Name, a.Name)
+		}
+		if isID(old) && isID(a) {
+			return fmt.Errorf("element %s: attribute %s: second ID attribute after %s", e.Name, a.Name, old.Name)
+		}
+	}
+	e.Attrs = append(e.Attrs, a)
+	return nil
+}
+
+// RemoveAttribute removes the attribute with the given name, if any.
+func (e *Element) RemoveAttribute(name string) {
+	for i, a := range e.Attrs {
+		if a.Name == name {
+			e.Attrs = append(e.Attrs[:i], e.Attrs[i+1:]...)
+			return
+		}
+	}
+}
+
+// inferType returns the type of an attribute written without one.  The names
+// id, idref and idrefs, in any case, have the type of the same name, number
+// is NMTOKEN and every other name is CDATA.
+func inferType(name string) string {
+	switch upper := strings.ToUpper(name); upper {
+	case "ID", "IDREF", "IDREFS":
+		return upper
+	case "NUMBER":
+		return "NMTOKEN"
+	}
+	return "CDATA"
+}
+
+func isID(a Attribute) bool {
+	return strings.TrimPrefix(a.Type, "#") == "ID"
+}
+
+// isIDRef reports whether a is an IDREF or IDREFS attribute.
+func isIDRef(a Attribute) bool {
+	typ := strings.TrimPrefix(a.Type, "#")
+	return typ == "IDREF" || typ == "IDREFS"
+}
+
+// isName reports whether s matches the XML Name production.
+func isName(s string) bool {
+	for i, r := range s {
+		if i == 0 && !unicode.IsLetter(r) && r != '_' && r != ':' {
+			return false
+		}
+		if !isNameChar(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isNmtoken reports whether s matches the XML Nmtoken production.
+func isNmtoken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !isNameChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-:", r) ||
+		unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r) || r == '\u00B7'
+}
+
+// isEnumeration reports whether an attribute type is an enumerated list.
+func isEnumeration(typ string) bool {
+	return strings.HasPrefix(typ, "(") && strings.HasSuffix(typ, ")")
+}
+
+// isNotation reports whether an attribute type is a NOTATION enumeration
+// like NOTATION (gif|jpeg).
+func isNotation(typ string) bool {
+	return strings.HasPrefix(typ, "NOTATION") && isEnumeration(strings.TrimSpace(typ[len("NOTATION"):]))
+}
+
+// notationValues returns the notation names of a NOTATION enumeration.
+func notationValues(typ string) []string {
+	return enumValues(strings.TrimSpace(typ[len("NOTATION"):]))
+}
+
+// enumValues splits an enumerated type like (left|right) into its values.
+func enumValues(typ string) []string {
+	values := strings.Split(typ[1:len(typ)-1], "|")
+	for i, v := range values {
+		values[i] = strings.TrimSpace(v)
+	}
+	return values
+}
+
+// quoteValue delimits an attribute value for a DTD declaration.  Double
+// quotes are preferred, single quotes are used when the value holds a double
+// quote, and when it holds both the double quotes are escaped as &quot;.
+func quoteValue(v string) string {
+	switch {
+	case !strings.Contains(v, `"`):
+		return `"` + v + `"`
+	case !strings.Contains(v, "'"):
+		return "'" + v + "'"
+	}
+	return `"` + strings.ReplaceAll(v, `"`, "&quot;") + `"`
+}
@@ -0,0 +1,180 @@
+package parser
+
+import "testing"
+
+func TestQuoteValue(t *testing.T) {
+	testCases := []struct {
+		value  string
+		expect string
+	}{
+		{`plain`, `"plain"`},
+		{`say "hi"`, `'say "hi"'`},
+		{`it's`, `"it's"`},
+		{`it's "hi"`, `"it's &quot;hi&quot;"`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.value, func(t *testing.T) {
+			if got := quoteValue(tC.value); got != tC.expect {
+				t.Errorf("Expected [%s], but found [%s]", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestAttributeValidate(t *testing.T) {
+	legal := []string{"CDATA", "ID", "IDREF", "IDREFS", "ENTITY", "ENTITIES", "NMTOKEN", "NMTOKENS",
+		"#ID", "#CDATA", "(left|right|center)", "( a | b.c | d-e )", "(1|2)",
+		"NOTATION (gif|jpeg)", "NOTATION(gif)"}
+	for _, typ := range legal {
+		t.Run(typ, func(t *testing.T) {
+			a := Attribute{Name: "x", Type: typ}
+			if err := a.Validate(); err != nil {
+				t.Errorf("Expected %s to be legal, but found %v", typ, err)
+			}
+		})
+	}
+
+	testCases := []struct {
+		typ    string
+		expect string
+	}{
+		{"", "attribute x has no type"},
+		{"#BOGUS", `attribute x: illegal type "#BOGUS"`},
+		{"id", `attribute x: illegal type "id"`},
+		{"(left|ri ght)", `attribute x: enumeration value "ri ght" is not a NMTOKEN`},
+		{"(left||right)", `attribute x: enumeration value "" is not a NMTOKEN`},
+		{"(left|right|left)", `attribute x: duplicate enumeration value "left"`},
+		{"NOTATION (gif|jpeg|gif)", `attribute x: duplicate notation "gif"`},
+		{"NOTATION (gif|1x)", `attribute x: notation "1x" is not a Name`},
+		{"NOTATION", `attribute x: illegal type "NOTATION"`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.typ, func(t *testing.T) {
+			a := Attribute{Name: "x", Type: tC.typ}
+			if err := a.Validate(); err == nil || err.Error() != tC.expect {
+				t.Errorf("Expected error [%s], but found [%v]", tC.expect, err)
+			}
+		})
+	}
+}
+
+func TestAttributeValidateDefault(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		attr   Attribute
+		expect string
+	}{
+		{`name=#REQUIRED "x"`, Attribute{Name: "name", Type: "CDATA", Occur: required, Default: "x"},
+			"attribute name: #REQUIRED attribute cannot have a default"},
+		{`name=#FIXED`, Attribute{Name: "name", Type: "CDATA", Occur: fixed},
+			"attribute name: #FIXED attribute must have a default"},
+		{`name=#FIXED "x"`, Attribute{Name: "name", Type: "CDATA", Occur: fixed, Default: "x"}, ""},
+		{`name="x"`, Attribute{Name: "name", Type: "CDATA", Default: "x"}, ""},
+		{`name=#REQUIRED`, Attribute{Name: "name", Type: "CDATA", Occur: required}, ""},
+		{`name=#IMPLIED "x"`, Attribute{Name: "name", Type: "CDATA", Occur: implied, Default: "x"},
+			"attribute name: #IMPLIED attribute cannot have a default"},
+		{`name=#IMPLIED`, Attribute{Name: "name", Type: "CDATA", Occur: implied}, ""},
+		{`id="x"`, Attribute{Name: "id", Type: "ID", Default: "x"},
+			"attribute id: ID attribute must be #IMPLIED or #REQUIRED"},
+		{`id=#FIXED "x"`, Attribute{Name: "id", Type: "ID", Occur: fixed, Default: "x"},
+			"attribute id: ID attribute must be #IMPLIED or #REQUIRED"},
+		{`id=#REQUIRED`, Attribute{Name: "id", Type: "ID", Occur: required}, ""},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.attr.Validate()
+			if tC.expect == "" {
+				if err != nil {
+					t.Errorf("Expected no error, but found [%v]", err)
+				}
+			} else if err == nil || err.Error() != tC.expect {
+				t.Errorf("Expected [%s], but found [%v]", tC.expect, err)
+			}
+		})
+	}
+}
+
+func TestValidateAttrs(t *testing.T) {
+	e := &Element{Name: "img", Attrs: []Attribute{
+		{Name: "format", Type: "NOTATION (gif|jpeg)"},
+		{Name: "alt", Type: "CDATA"},
+		{Name: "fallback", Type: "NOTATION (png)"},
+		{Name: "size", Type: "(big|big)"},
+		{Name: "id", Type: "ID"},
+		{Name: "key", Type: "ID"},
+		{Name: "alt", Type: "CDATA"},
+	}}
+	expect := []string{
+		"element img: attribute fallback: second NOTATION attribute after format",
+		`element img: attribute size: duplicate enumeration value "big"`,
+		"element img: attribute key: second ID attribute after id",
+		"element img: duplicate attribute alt",
+	}
+	errs := e.ValidateAttrs()
+	if len(errs) != len(expect) {
+		t.Fatalf("Expected %d errors, but found %v", len(expect), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expect[i] {
+			t.Errorf("Expected [%s], but found [%v]", expect[i], err)
+		}
+	}
+}
+
+func TestAddAttribute(t *testing.T) {
+	e := &Element{Name: "paragraph"}
+	if err := e.AddAttribute(Attribute{Name: "id", Type: "ID", Occur: implied}); err != nil {
+		t.Fatalf("Expected id to be added, but found %v", err)
+	}
+	if err := e.AddAttribute(Attribute{Name: "name", Type: "CDATA", Occur: implied}); err != nil {
+		t.Fatalf("Expected name to be added, but found %v", err)
+	}
+
+	testCases := []struct {
+		attr   Attribute
+		expect string
+	}{
+		{Attribute{Name: "name", Type: "NMTOKEN"}, "element paragraph: duplicate attribute name"},
+		{Attribute{Name: "key", Type: "#ID"}, "element paragraph: attribute key: second ID attribute after id"},
+		{Attribute{Name: "bad", Type: "#BOGUS"}, `element paragraph: attribute bad: illegal type "#BOGUS"`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.expect, func(t *testing.T) {
+			if err := e.AddAttribute(tC.attr); err == nil || err.Error() != tC.expect {
+				t.Errorf("Expected [%s], but found [%v]", tC.expect, err)
+			}
+		})
+	}
+	if len(e.Attrs) != 2 {
+		t.Errorf("Expected rejected attributes to be left out, but found %v", e.Attrs)
+	}
+
+	e.RemoveAttribute("id")
+	e.RemoveAttribute("missing")
+	if len(e.Attrs) != 1 || e.Attrs[0].Name != "name" {
+		t.Errorf("Expected only name to remain, but found %v", e.Attrs)
+	}
+}
+
+func TestInferType(t *testing.T) {
+	testCases := []struct {
+		name   string
+		expect string
+	}{
+		{"id", "ID"},
+		{"Id", "ID"},
+		{"idref", "IDREF"},
+		{"IDREFS", "IDREFS"},
+		{"number", "NMTOKEN"},
+		{"Number", "NMTOKEN"},
+		{"numbers", "CDATA"},
+		{"name", "CDATA"},
+		{"cdata", "CDATA"},
+		{"ids", "CDATA"},
+	}
+	for _, tC := range testCases {
+		if got := inferType(tC.name); got != tC.expect {
+			t.Errorf("Expected %s to infer %s, but found %s", tC.name, tC.expect, got)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Errors that Check wraps, so callers can tell the kinds of problem apart
+// with errors.Is.
+var (
+	// ErrUndefined marks a reference to an element that is never defined.
+	ErrUndefined = errors.New("never defined")
+	// ErrUnreachable marks a definition the root does not reach.
+	ErrUnreachable = errors.New("not reachable")
+	// ErrMixedContent marks #PCDATA outside the one form XML allows.
+	ErrMixedContent = errors.New("illegal mixed content")
+	// ErrInvalidAttribute marks an attribute declaration XML rejects.
+	ErrInvalidAttribute = errors.New("invalid attribute")
+	// ErrInvalidContent marks a content model no DTDX or DTD could express.
+	ErrInvalidContent = errors.New("invalid content model")
+)
+
+// Check parses the DTDX document read from src and checks it without writing
+// any output, as a CI gate does.  It returns the Summary of the document and
+// a Diagnostic for each warning of the parse and each problem that the Check
+// method finds, in that order.  A document that does not parse is the error,
+// with the warnings found before it.
+func Check(src io.Reader) (Report, []Diagnostic, error) {
+	var diags []Diagnostic
+	p := NewParser(src)
+	p.Warn = func(d Diagnostic) { diags = append(diags, d) }
+	root, err := p.Parse()
+	if err != nil {
+		return Report{}, diags, err
+	}
+	for _, err := range root.Check() {
+		diags = append(diags, Diagnostic{Msg: err.Error()})
+	}
+	return Summary(root), diags, nil
+}
+
+// Check reports the problems of the document rooted at e that still parse.
+// Each reference to an undefined element, which defaults to (#PCDATA), is
+// reported at its first reference.  When e is the root returned by Parse, a
+// definition that e does not reach, directly or through other elements, is
+// reported too; the caller decides whether that is fatal.
+//
+// Check also applies the XML rule for mixed content, which the parser does
+// not enforce: #PCDATA is either the whole content model or the first member
+// of a choice of element names repeated with *, as in (#PCDATA | b | i)*,
+// and none of those names has a modifier of its own.
+//
+// The attribute list of every element is checked with ValidateAttrs, which
+// catches a second ID attribute, an ID attribute with a default, and
+// enumerations that are not NMTOKENs or repeat a value, even in a document
+// that was not built through AddAttribute.
+func (e *Element) Check() []error {
+	var errs []error
+	reached := map[*Element]bool{}
+	for _, r := range reachable(e) {
+		reached[r] = true
+		if r.undefined {
+			errs = append(errs, fmt.Errorf("line %d, col %d: element %s is referenced but %w", r.line, r.col, r.Name, ErrUndefined))
+		}
+		if !r.Content.mixedLegal() {
+			content := r.Content.render(func(e *Element) string { return e.Name })
+			if name, m := r.Content.modifiedMember(); m != singleMultiplicity {
+				errs = append(errs, fmt.Errorf("line %d, col %d: element %s has %w %s; %s may not have its own %s in mixed content", r.line, r.col, r.Name, ErrMixedContent, content, name, m))
+			} else {
+				errs = append(errs, fmt.Errorf("line %d, col %d: element %s has %w %s; #PCDATA may only start a choice of element names repeated with *", r.line, r.col, r.Name, ErrMixedContent, content))
+			}
+		}
+		errs = append(errs, r.checkAttrs()...)
+	}
+	for _, d := range e.defs {
+		if !reached[d] {
+			errs = append(errs, fmt.Errorf("line %d, col %d: element %s is %w from %s", d.line, d.col, d.Name, ErrUnreachable, e.Name))
+			errs = append(errs, d.checkAttrs()...)
+		}
+	}
+	return errs
+}
+
+// checkAttrs returns the errors of ValidateAttrs at the position of e.
+func (e *Element) checkAttrs() []error {
+	var errs []error
+	for _, err := range e.ValidateAttrs() {
+		errs = append(errs, fmt.Errorf("line %d, col %d: %w: %v", e.line, e.col, ErrInvalidAttribute, err))
+	}
+	return errs
+}
+
+// Validate reports the first impossible state in the content model c or its
+// children: a group with no members, or with several but no separator, a
+// sequence or choice of fewer than two members, an element particle with no
+// element, or #PCDATA repeated other than with *.  Parse never builds such a
+// model, but one built or decoded elsewhere can be checked before it is
+// written.  The rule for mixed content is left to Check.
+func (c *ContentModel) Validate() error {
+	n := len(c.children)
+	switch c.modelType {
+	case groupModelType:
+		if n == 0 {
+			return fmt.Errorf("%w: group with no members", ErrInvalidContent)
+		}
+		if n > 1 {
+			return fmt.Errorf("%w: group of %d members with no separator", ErrInvalidContent, n)
+		}
+	case sequenceModelType, choiceModelType:
+		if n < 2 {
+			return fmt.Errorf("%w: %s of %d members", ErrInvalidContent, jsonModelTypes[c.modelType], n)
+		}
+	case elementModelType:
+		if c.element == nil {
+			return fmt.Errorf("%w: element particle with no element", ErrInvalidContent)
+		}
+	case pcdataModelType:
+		if c.multiplicity != singleMultiplicity && c.multiplicity != zeroOrMoreMultiplicity {
+			return fmt.Errorf("%w: #PCDATA%s", ErrInvalidContent, c.multiplicity)
+		}
+	}
+	for _, child := range c.children {
+		if err := child.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mixedLegal reports whether c uses #PCDATA only in a form XML allows:
+// (#PCDATA), (#PCDATA)*, or (#PCDATA | name | ...)* with plain names, some of
+// which may come from parameter entities.
+func (c *ContentModel) mixedLegal() bool {
+	if !c.hasPCDATA() {
+		return true
+	}
+	repeated := c.multiplicity == zeroOrMoreMultiplicity
+	switch {
+	case c.modelType == pcdataModelType:
+		return c.multiplicity == singleMultiplicity || repeated
+	case c.modelType == groupModelType && len(c.children) == 1:
+		child := c.children[0]
+		return child.modelType == pcdataModelType && child.multiplicity == singleMultiplicity &&
+			(c.multiplicity == singleMultiplicity || repeated)
+	case c.modelType != choiceModelType || !repeated:
+		return false
+	}
+	for i, child := range c.children {
+		first := child.modelType == pcdataModelType
+		if (i == 0) != first || (!first && !child.plainNames()) || child.multiplicity != singleMultiplicity {
+			return false
+		}
+	}
+	return true
+}
+
+// modifiedMember returns the first element or entity that is a member of the
+// mixed content c and carries a modifier of its own, as bold does in
+// (#PCDATA | bold+)*, or a single multiplicity when there is none.
+func (c *ContentModel) modifiedMember() (string, multiplicity) {
+	if !c.hasPCDATA() {
+		return "", singleMultiplicity
+	}
+	for _, child := range c.children {
+		if child.multiplicity == singleMultiplicity {
+			continue
+		}
+		switch child.modelType {
+		case elementModelType:
+			return child.element.Name, child.multiplicity
+		case entityModelType:
+			return "%" + child.entity.Name + ";", child.multiplicity
+		}
+	}
+	return "", singleMultiplicity
+}
+
+// plainNames reports whether c is an element name with no modifier, or a
+// parameter entity that stands for a choice of such names.
+func (c *ContentModel) plainNames() bool {
+	if c.multiplicity != singleMultiplicity {
+		return false
+	}
+	switch c.modelType {
+	case elementModelType:
+		return true
+	case entityModelType:
+		if len(c.children) == 0 {
+			return false
+		}
+		content := c.children[0]
+		switch {
+		case content.multiplicity != singleMultiplicity:
+			return false
+		case content.modelType == choiceModelType, content.modelType == groupModelType:
+			for _, child := range content.children {
+				if !child.plainNames() {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
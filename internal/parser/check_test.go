@@ -0,0 +1,219 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	src := "paragraph\n" +
+		"  title?\n" +
+		"  line...+\n" +
+		"  lnie...\n" +
+		"orphan\n" +
+		"  line\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := root.Check()
+	expect := []string{
+		"line 4, col 3: element lnie is referenced but never defined",
+		"line 5, col 1: element orphan is not reachable from paragraph",
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("Expected %q, but found %v", expect, errs)
+	}
+	for i, msg := range expect {
+		if errs[i].Error() != msg {
+			t.Errorf("Expected %q, but found %q", msg, errs[i])
+		}
+	}
+	if !errors.Is(errs[0], ErrUndefined) || !errors.Is(errs[1], ErrUnreachable) {
+		t.Errorf("Expected the errors to wrap ErrUndefined and ErrUnreachable")
+	}
+}
+
+func TestCheckSource(t *testing.T) {
+	src := "paragraph id=\n" +
+		"  title?\n" +
+		"  lnie...+\n" +
+		"orphan\n"
+	report, diags, err := Check(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"warning: line 3, col 3: element lnie is referenced but never defined",
+		"warning: line 4, col 1: element orphan is not reachable from paragraph",
+	}
+	if len(diags) != len(expect) {
+		t.Fatalf("Expected %q, but found %v", expect, diags)
+	}
+	for i, msg := range expect {
+		if diags[i].String() != msg {
+			t.Errorf("Expected %q, but found %q", msg, diags[i])
+		}
+	}
+	if report.Elements != 3 || report.WithAttributes != 1 || report.References != 2 {
+		t.Errorf("Expected a report of 3 elements, 1 with attributes and 2 references, but found %+v", report)
+	}
+	if _, _, err := Check(strings.NewReader("a\n  (b")); err == nil {
+		t.Errorf("Expected a document that does not parse to be an error")
+	}
+}
+
+func TestCheckClean(t *testing.T) {
+	root, err := NewParser(strings.NewReader("a\n  b...*\nb\n  a...?")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := root.Check(); len(errs) != 0 {
+		t.Errorf("Expected no errors, but found %v", errs)
+	}
+}
+
+func TestCheckMixedContent(t *testing.T) {
+	testCases := []struct {
+		content string
+		legal   bool
+	}{
+		{"PCDATA", true},
+		{"(PCDATA)*", true},
+		{"(#PCDATA | b | i)*", true},
+		{"(b | i)+", true},
+		{"(#PCDATA, b)*", false},
+		{"(#PCDATA | b)", false},
+		{"(#PCDATA | b)+", false},
+		{"(b | #PCDATA)*", false},
+		{"(#PCDATA | b?)*", false},
+		{"(#PCDATA | (b, i))*", false},
+		{"(PCDATA*)", false},
+		{"((#PCDATA | b)*, i)", false},
+		{"(#PCDATA | %names)*\n%names = (b | i)", true},
+		{"(#PCDATA | %names)*\n%names = b?", false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.content, func(t *testing.T) {
+			root, err := NewParser(strings.NewReader("a\n  " + tC.content)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mixed []error
+			for _, err := range root.Check() {
+				if errors.Is(err, ErrMixedContent) {
+					mixed = append(mixed, err)
+				}
+			}
+			if legal := len(mixed) == 0; legal != tC.legal {
+				t.Errorf("Expected legal=%v, but found %v", tC.legal, mixed)
+			}
+		})
+	}
+}
+
+func TestCheckMixedContentMessage(t *testing.T) {
+	testCases := []struct {
+		content string
+		expect  string
+	}{
+		{"(PCDATA, bold)*", "line 1, col 1: element line has illegal mixed content (#PCDATA, bold)*; #PCDATA may only start a choice of element names repeated with *"},
+		{"(PCDATA, bold+)*", "line 1, col 1: element line has illegal mixed content (#PCDATA, bold+)*; bold may not have its own + in mixed content"},
+		{"(#PCDATA | bold | em?)*", "line 1, col 1: element line has illegal mixed content (#PCDATA | bold | em?)*; em may not have its own ? in mixed content"},
+		{"(#PCDATA | bold | em)*", ""},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.content, func(t *testing.T) {
+			root, err := NewParser(strings.NewReader("line\n  " + tC.content)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			errs := root.Check()
+			if tC.expect == "" {
+				if len(errs) != 0 {
+					t.Errorf("Expected no errors, but found %v", errs)
+				}
+			} else if len(errs) != 1 || errs[0].Error() != tC.expect || !errors.Is(errs[0], ErrMixedContent) {
+				t.Errorf("Expected %q, but found %v", tC.expect, errs)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	pcdata := func(m multiplicity) *ContentModel { return &ContentModel{modelType: pcdataModelType, multiplicity: m} }
+	testCases := []struct {
+		desc    string
+		content *ContentModel
+		expect  string
+	}{
+		{"element", ref("a", "?"), ""},
+		{"choice", group(choiceModelType, "*", pcdata(""), ref("a", "")), ""},
+		{"pcdata repeated", group(groupModelType, "", pcdata("*")), ""},
+		{"empty group", group(groupModelType, ""), "invalid content model: group with no members"},
+		{"group without separator", group(groupModelType, "", ref("a", ""), ref("b", "")), "invalid content model: group of 2 members with no separator"},
+		{"nil element", &ContentModel{modelType: elementModelType}, "invalid content model: element particle with no element"},
+		{"short sequence", group(sequenceModelType, "", ref("a", "")), "invalid content model: sequence of 1 members"},
+		{"empty choice", group(choiceModelType, "+"), "invalid content model: choice of 0 members"},
+		{"optional pcdata", pcdata("?"), "invalid content model: #PCDATA?"},
+		{"nested", group(sequenceModelType, "", ref("a", ""), group(choiceModelType, "", pcdata("+"), ref("b", ""))), "invalid content model: #PCDATA+"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.content.Validate()
+			switch {
+			case tC.expect == "" && err != nil:
+				t.Errorf("Expected no error, but found %v", err)
+			case tC.expect != "" && (err == nil || err.Error() != tC.expect || !errors.Is(err, ErrInvalidContent)):
+				t.Errorf("Expected error %q, but found %v", tC.expect, err)
+			}
+		})
+	}
+}
+
+func TestValidateParsed(t *testing.T) {
+	for _, e := range reachable(docExample()) {
+		if err := e.Content.Validate(); err != nil {
+			t.Errorf("element %s: %v", e.Name, err)
+		}
+	}
+	choice := group(choiceModelType, "", ref("a", ""), ref("b", "")).String()
+	sequence := group(sequenceModelType, "", ref("a", ""), ref("b", "")).String()
+	if choice != "(a | b)" || sequence != "(a, b)" {
+		t.Errorf("Expected (a | b) and (a, b), but found %s and %s", choice, sequence)
+	}
+}
+
+func TestCheckAttributes(t *testing.T) {
+	root, err := NewParser(strings.NewReader("doc\n  img\norphan\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, orphan := root.defs[1], root.defs[2]
+	img.Attrs = []Attribute{ // as a decoder might build them, without AddAttribute
+		{Name: "id", Type: "ID", Occur: fixed, Default: "x"},
+		{Name: "key", Type: "ID", Occur: implied},
+		{Name: "format", Type: "NOTATION (gif|gif)", Occur: implied},
+	}
+	orphan.Attrs = []Attribute{{Name: "size", Type: "(big|1.5|a b)", Occur: implied}}
+	expect := []string{
+		"line 2, col 3: invalid attribute: element img: attribute id: ID attribute must be #IMPLIED or #REQUIRED",
+		"line 2, col 3: invalid attribute: element img: attribute key: second ID attribute after id",
+		`line 2, col 3: invalid attribute: element img: attribute format: duplicate notation "gif"`,
+		"line 3, col 1: element orphan is not reachable from doc",
+		`line 3, col 1: invalid attribute: element orphan: attribute size: enumeration value "a b" is not a NMTOKEN`,
+	}
+	errs := root.Check()
+	if len(errs) != len(expect) {
+		t.Fatalf("Expected %q, but found %v", expect, errs)
+	}
+	for i, msg := range expect {
+		if errs[i].Error() != msg {
+			t.Errorf("Expected %q, but found %q", msg, errs[i])
+		}
+	}
+	if !errors.Is(errs[0], ErrInvalidAttribute) {
+		t.Errorf("Expected the error to wrap ErrInvalidAttribute")
+	}
+}
@@ -0,0 +1,22 @@
+package parser
+
+import "fmt"
+
+// Diagnostic is a message about the document that does not stop the parse,
+// such as a warning about a construct that was accepted but is suspicious.
+type Diagnostic struct {
+	Msg string // human readable description of the problem
+}
+
+func (d Diagnostic) String() string {
+	return "warning: " + d.Msg
+}
+
+// warnf formats a Diagnostic and hands it to the parser's Warn sink.
+// Warnings are discarded when no sink has been configured.
+func (p *Parser) warnf(format string, args ...interface{}) {
+	if p.Warn == nil {
+		return
+	}
+	p.Warn(Diagnostic{Msg: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,689 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteDTD writes the <!ELEMENT> and <!ATTLIST> declarations of root and of
+// every element it reaches, each once, root first and then in the order the
+// content models reach them.  Names and attribute columns are padded so the
+// declarations line up.  An element without a content model is (#PCDATA).
+// The comments on a definition come right before its <!ELEMENT>.
+// An element whose name or attributes use a namespace prefix, as html:body
+// does, gets an xmlns:html attribute unless it declares one itself.
+//
+// DTDs have no & groups, so each one is written as the choice of all the
+// orderings of its members: (a & b) becomes ((a, b) | (b, a)).  A group of
+// more than maxAllMembers members is an error rather than a huge choice.
+//
+// The parameter entities that the content models use come first, each after
+// the entities it uses.  An entity that stands for a choice is declared
+// without its parentheses when every reference sits directly in a choice, as
+// in (#PCDATA | %inline;)*, so the references stay legal mixed content.
+func WriteDTD(w io.Writer, root *Element) error {
+	return DTDOptions{}.WriteDTD(w, root)
+}
+
+// DTDOptions control how a DTD is written.  The zero value writes the DTD
+// that WriteDTD writes.
+type DTDOptions struct {
+	// SplitAttlists writes an <!ATTLIST> for each attribute list declaration
+	// that the attributes of an element were read from, in order, rather
+	// than one for all of them.  A DTDX definition has one.
+	SplitAttlists bool
+
+	// Banner starts the DTD with a comment saying that dtdx generated it and
+	// that it is not to be edited, naming the file the document was parsed
+	// from when NewFileParser read it.
+	Banner bool
+	// Timestamp, unless zero, is written on a second banner line as the time
+	// the DTD was generated.  It is opt-in so that the output stays the same
+	// from one run to the next.
+	Timestamp time.Time
+
+	// Flatten writes a DTD with no parameter entities: each reference is
+	// replaced by the content of its entity, whose members join a choice or
+	// sequence of the same kind, as %inline; does in (#PCDATA | %inline;)*.
+	// Attribute types never refer to entities, so they are written as ever.
+	Flatten bool
+
+	// SortEnumerations writes the values of each enumerated or NOTATION
+	// attribute type in sorted order, for output that does not depend on the
+	// order they were written in.  By default they keep that order.
+	SortEnumerations bool
+
+	// ElementLess, unless nil, orders the declarations of the elements: a
+	// comes before b when it reports true, and elements it does not order
+	// keep the order WriteDTD writes them in.
+	ElementLess func(a, b *Element) bool
+
+	// Leaves places the declarations of the leaf elements, those whose
+	// content is just (#PCDATA), among or apart from the others.
+	Leaves LeafPlacement
+
+	// CollapseOptional writes a sequence of optional particles repeated
+	// with *, like (a?, b?, c?)*, as the choice (a | b | c)*, the usual DTD
+	// form.  That choice allows the particles in any order, so each one
+	// collapsed is reported to Warn, if set.
+	CollapseOptional bool
+	// Warn receives the warnings found while writing.
+	Warn func(Diagnostic)
+
+	// FactorPrefixes declares the attributes of an element whose names share
+	// a prefix ending in -, like data-id and data-role, in a parameter entity
+	// named after the prefix, %data;, that its <!ATTLIST> refers to.  Only a
+	// prefix of at least PrefixThreshold attributes, or 3 when it is 0, is
+	// factored.  Elements with the same declarations for a prefix share its
+	// entity; another element, or one whose prefix names a parameter entity
+	// of the content, gets its own, named after it too, as in %p.data;.
+	FactorPrefixes  bool
+	PrefixThreshold int
+}
+
+// LeafPlacement says where a DTD declares its leaf elements.
+type LeafPlacement int
+
+const (
+	// Inline declares each leaf where the content models reach it (the
+	// default).
+	Inline LeafPlacement = iota
+	// End declares the leaves after the other elements.
+	End
+	// Start declares the leaves before the other elements.
+	Start
+)
+
+// WriteDTD writes the DTD of root as the function WriteDTD does, with the
+// options of o.
+func (o DTDOptions) WriteDTD(w io.Writer, root *Element) error {
+	bw := bufio.NewWriter(w)
+	if err := o.write(bw, bw, root); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// GenerateSplit writes the DTD that WriteDTD writes for root in two parts:
+// the parameter entities and <!ELEMENT> declarations to elementsW, and the
+// <!ATTLIST> declarations to attlistsW.
+func GenerateSplit(root *Element, elementsW, attlistsW io.Writer) error {
+	return DTDOptions{}.GenerateSplit(root, elementsW, attlistsW)
+}
+
+// GenerateSplit writes the DTD that o.WriteDTD writes for root in the two
+// parts the function GenerateSplit does.  Each part starts with the banner.
+func (o DTDOptions) GenerateSplit(root *Element, elementsW, attlistsW io.Writer) error {
+	ew, aw := bufio.NewWriter(elementsW), bufio.NewWriter(attlistsW)
+	if o.Banner {
+		o.writeBanner(aw, root)
+	}
+	if err := o.write(ew, aw, root); err != nil {
+		return err
+	}
+	if err := ew.Flush(); err != nil {
+		return err
+	}
+	return aw.Flush()
+}
+
+// write writes the DTD of root, its <!ATTLIST> declarations to aw and the
+// rest to ew.
+func (o DTDOptions) write(ew, aw io.Writer, root *Element) error {
+	if o.Banner {
+		o.writeBanner(ew, root)
+	}
+	elements := reachable(root)
+	entities, bare := usedEntities(elements)
+	if o.Flatten {
+		entities = nil
+	}
+	if o.ElementLess != nil {
+		sort.SliceStable(elements, func(i, j int) bool { return o.ElementLess(elements[i], elements[j]) })
+	}
+	if o.Leaves != Inline {
+		elements = placeLeaves(elements, o.Leaves == Start)
+	}
+	return o.declarations(ew, aw, elements, entities, bare)
+}
+
+// placeLeaves returns elements with the leaves before the others when first
+// is true and after them otherwise, each part in its order in elements.
+func placeLeaves(elements []*Element, first bool) []*Element {
+	var leaves, others []*Element
+	for _, e := range elements {
+		if c := e.Content; c.modelType == unknownModelType || c.modelType == pcdataModelType && c.multiplicity == singleMultiplicity {
+			leaves = append(leaves, e)
+		} else {
+			others = append(others, e)
+		}
+	}
+	if first {
+		return append(leaves, others...)
+	}
+	return append(others, leaves...)
+}
+
+// declarations writes the declarations of entities to ew, declaring those in
+// bare without their outer parentheses, then the <!ELEMENT> declarations of
+// elements to ew and their <!ATTLIST> declarations to aw.
+func (o DTDOptions) declarations(ew, aw io.Writer, elements []*Element, entities []*Entity, bare map[*Entity]bool) error {
+	for _, e := range entities {
+		expanded, err := expandAll(&e.Content)
+		if err != nil {
+			return fmt.Errorf("entity %%%s: %v", e.Name, err)
+		}
+		body := expanded.String()
+		if bare[e] {
+			body = body[1 : len(body)-1]
+		}
+		fmt.Fprintf(ew, "<!ENTITY %% %s %s>\n", e.Name, quoteValue(body))
+	}
+	factored, refs := o.prefixEntities(elements, entities)
+	for _, pe := range factored {
+		o.writePrefixEntity(ew, pe)
+	}
+	width := 0
+	for _, e := range elements {
+		if len(e.Name) > width {
+			width = len(e.Name)
+		}
+	}
+	for _, e := range elements {
+		content := &e.Content
+		if o.Flatten {
+			content = inlineEntities(content)
+		}
+		if o.CollapseOptional {
+			content = o.collapseOptional(e, content)
+		}
+		expanded, err := expandAll(content)
+		if err != nil {
+			return fmt.Errorf("element %s: %v", e.Name, err)
+		}
+		body := expanded.String()
+		if e.Content.modelType == unknownModelType {
+			body = "(#PCDATA)"
+		}
+		for _, line := range e.Doc {
+			fmt.Fprintf(ew, "<!-- %s -->\n", commentText(line))
+		}
+		fmt.Fprintf(ew, "<!ELEMENT %-*s %s>\n", width, e.Name, body)
+	}
+	for _, e := range elements {
+		o.writeAttlists(aw, e, refs[e])
+	}
+	return nil
+}
+
+// ElementDTD returns the <!ELEMENT> and <!ATTLIST> declarations of the
+// element name that the last document parsed defines, after those of the
+// parameter entities its content refers to directly.  Each is written as in
+// the DTD of the whole document.  An element that is not defined there is
+// an error.
+func (p *Parser) ElementDTD(name string) (string, error) {
+	e := p.elements[name]
+	if e == nil {
+		return "", fmt.Errorf("element %s is not defined", name)
+	}
+	var all []*Element
+	for _, name := range p.order {
+		all = append(all, p.elements[name])
+	}
+	_, bare := usedEntities(all)
+	var buf bytes.Buffer
+	if err := (DTDOptions{}).declarations(&buf, &buf, []*Element{e}, directEntities(&e.Content), bare); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// directEntities lists the parameter entities that c refers to, in order,
+// but not those that only their content refers to.
+func directEntities(c *ContentModel) []*Entity {
+	var result []*Entity
+	seen := map[*Entity]bool{}
+	var visit func(c *ContentModel)
+	visit = func(c *ContentModel) {
+		if c.modelType == entityModelType {
+			if !seen[c.entity] {
+				seen[c.entity] = true
+				result = append(result, c.entity)
+			}
+			return
+		}
+		for _, child := range c.children {
+			visit(child)
+		}
+	}
+	visit(c)
+	return result
+}
+
+// GenerateBytes returns the DTD that WriteDTD writes for root.
+func GenerateBytes(root *Element) ([]byte, error) {
+	return DTDOptions{}.GenerateBytes(root)
+}
+
+// GenerateBytes returns the DTD that o.WriteDTD writes for root.
+func (o DTDOptions) GenerateBytes(root *Element) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := o.WriteDTD(&buf, root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBanner writes the banner comment for the DTD of root.
+func (o DTDOptions) writeBanner(w io.Writer, root *Element) {
+	from := ""
+	if root.source != "" {
+		from = " from " + filepath.Base(root.source)
+	}
+	fmt.Fprintf(w, "<!-- Generated%s by dtdx; do not edit -->\n", commentText(from))
+	if !o.Timestamp.IsZero() {
+		fmt.Fprintf(w, "<!-- Generated at %s -->\n", o.Timestamp.UTC().Format(time.RFC3339))
+	}
+}
+
+// commentText makes s safe to write in an XML comment, which may not hold
+// --, by putting a space between each two dashes in a row.
+func commentText(s string) string {
+	for strings.Contains(s, "--") {
+		s = strings.ReplaceAll(s, "--", "- -")
+	}
+	return s
+}
+
+// usedEntities lists the parameter entities that the content models of
+// elements use, each after the entities its own content uses.  It also
+// reports which of them may be declared without their outer parentheses: a
+// choice, or a single particle, whose references all sit unmodified in a
+// choice or alone in a group.
+func usedEntities(elements []*Element) ([]*Entity, map[*Entity]bool) {
+	var result []*Entity
+	bare := map[*Entity]bool{}
+	seen := map[*Entity]bool{}
+	var visit func(c, parent *ContentModel)
+	visit = func(c, parent *ContentModel) {
+		if c.modelType != entityModelType {
+			for _, child := range c.children {
+				visit(child, c)
+			}
+			return
+		}
+		e := c.entity
+		inChoice := parent != nil && (parent.modelType == choiceModelType ||
+			parent.modelType == groupModelType && len(parent.children) == 1)
+		if !seen[e] {
+			seen[e] = true
+			content := &e.Content
+			bare[e] = content.multiplicity == singleMultiplicity &&
+				(content.modelType == choiceModelType || content.modelType == groupModelType)
+			visit(content, nil)
+			result = append(result, e)
+		}
+		if !inChoice || c.multiplicity != singleMultiplicity {
+			bare[e] = false
+		}
+	}
+	for _, e := range elements {
+		visit(&e.Content, nil)
+	}
+	return result, bare
+}
+
+// inlineEntities returns a copy of c in which every parameter entity
+// reference is replaced by the content of its entity.  The members of an
+// unmodified reference to a group join its parent group when that is of the
+// same kind, or when the group holds only one member, and a group that holds
+// only a group becomes that group.
+func inlineEntities(c *ContentModel) *ContentModel {
+	if c.modelType == entityModelType {
+		if len(c.children) == 0 {
+			return c
+		}
+		content := inlineEntities(c.children[0])
+		switch {
+		case c.multiplicity == singleMultiplicity:
+			return content
+		case content.multiplicity == singleMultiplicity:
+			result := *content
+			result.multiplicity = c.multiplicity
+			return &result
+		}
+		return &ContentModel{modelType: groupModelType, multiplicity: c.multiplicity, children: []*ContentModel{content}}
+	}
+	result := *c
+	result.children = nil
+	for _, child := range c.children {
+		inlined := inlineEntities(child)
+		if child.modelType == entityModelType && inlined != child && inlined.multiplicity == singleMultiplicity &&
+			(inlined.modelType == c.modelType || inlined.modelType == groupModelType && len(inlined.children) == 1) {
+			result.children = append(result.children, inlined.children...)
+			continue
+		}
+		result.children = append(result.children, inlined)
+	}
+	if result.modelType == groupModelType && len(result.children) == 1 && isGroup(result.children[0]) {
+		inner := *result.children[0]
+		switch {
+		case result.multiplicity == singleMultiplicity:
+			return &inner
+		case inner.multiplicity == singleMultiplicity:
+			inner.multiplicity = result.multiplicity
+			return &inner
+		}
+	}
+	return &result
+}
+
+// collapseOptional returns a copy of c, the content of e, in which every
+// sequence of optional particles repeated with * is a choice of the
+// particles without their ?, and warns about each.
+func (o DTDOptions) collapseOptional(e *Element, c *ContentModel) *ContentModel {
+	result := *c
+	result.children = make([]*ContentModel, len(c.children))
+	for i, child := range c.children {
+		result.children[i] = o.collapseOptional(e, child)
+	}
+	sequence := c.modelType == sequenceModelType || c.modelType == groupModelType && len(c.children) > 1
+	if !sequence || c.multiplicity != zeroOrMoreMultiplicity {
+		return &result
+	}
+	for _, child := range result.children {
+		if child.multiplicity != optionalMultiplicity {
+			return &result
+		}
+	}
+	before := result.String()
+	result.modelType = choiceModelType
+	for i, child := range result.children {
+		member := *child
+		member.multiplicity = singleMultiplicity
+		result.children[i] = &member
+	}
+	if o.Warn != nil {
+		o.Warn(Diagnostic{Msg: fmt.Sprintf("element %s: %s is written as %s, which allows its members in any order", e.Name, before, result.String())})
+	}
+	return &result
+}
+
+// maxAllMembers is the largest & group that WriteDTD expands.  Its 5 members
+// already make 120 orderings.
+const maxAllMembers = 5
+
+// expandAll returns a copy of c in which every & group is replaced by the
+// choice of the orderings of its members, in a fixed order.
+func expandAll(c *ContentModel) (*ContentModel, error) {
+	result := *c
+	result.children = make([]*ContentModel, len(c.children))
+	for i, child := range c.children {
+		expanded, err := expandAll(child)
+		if err != nil {
+			return nil, err
+		}
+		result.children[i] = expanded
+	}
+	if c.modelType != allModelType {
+		return &result, nil
+	}
+	if len(c.children) > maxAllMembers {
+		return nil, fmt.Errorf("& group of %d members exceeds the limit of %d for expansion", len(c.children), maxAllMembers)
+	}
+	choice := &ContentModel{modelType: choiceModelType, multiplicity: c.multiplicity}
+	for _, order := range orderings(result.children) {
+		choice.children = append(choice.children, &ContentModel{modelType: sequenceModelType, children: order})
+	}
+	return choice, nil
+}
+
+// orderings lists the permutations of items, those starting with earlier
+// items first.
+func orderings(items []*ContentModel) [][]*ContentModel {
+	if len(items) <= 1 {
+		return [][]*ContentModel{items}
+	}
+	var result [][]*ContentModel
+	for i, first := range items {
+		rest := append(append([]*ContentModel{}, items[:i]...), items[i+1:]...)
+		for _, order := range orderings(rest) {
+			result = append(result, append([]*ContentModel{first}, order...))
+		}
+	}
+	return result
+}
+
+// writeAttlists writes the attribute list declarations of e: one, or with
+// SplitAttlists one for each block of attributes, where the xmlns attributes
+// that e lacks join the last.  The attributes of the entities in refs are
+// left to them, and the first declaration refers to the entities instead.
+func (o DTDOptions) writeAttlists(w io.Writer, e *Element, refs []*prefixEntity) {
+	attrs, own := withXmlns(e), len(e.Attrs)
+	var names []string
+	for _, pe := range refs {
+		names = append(names, pe.name)
+		attrs, own = withoutAttrs(attrs, own, pe.attrs)
+	}
+	if o.SortEnumerations {
+		attrs = sortEnumerations(attrs)
+	}
+	if !o.SplitAttlists || len(attrs) == 0 {
+		writeAttlist(w, e.Name, attrs, names)
+		return
+	}
+	start := 0
+	for i := 1; i <= len(attrs); i++ {
+		if i == len(attrs) || i < own && attrs[i].block != attrs[start].block {
+			writeAttlist(w, e.Name, attrs[start:i], names)
+			start, names = i, nil
+		}
+	}
+}
+
+// prefixEntity is a parameter entity that FactorPrefixes declares for the
+// attributes that share a prefix.
+type prefixEntity struct {
+	name  string
+	attrs []Attribute
+}
+
+// prefixEntities returns the parameter entities that FactorPrefixes makes of
+// the attributes of elements, in order, and those that the attribute list of
+// each element refers to.  The parameter entities of the content, entities,
+// keep their names.
+func (o DTDOptions) prefixEntities(elements []*Element, entities []*Entity) ([]*prefixEntity, map[*Element][]*prefixEntity) {
+	if !o.FactorPrefixes {
+		return nil, nil
+	}
+	threshold := o.PrefixThreshold
+	if threshold <= 0 {
+		threshold = 3
+	}
+	taken := map[string]bool{}
+	for _, e := range entities {
+		taken[e.Name] = true
+	}
+	var result []*prefixEntity
+	byName := map[string]*prefixEntity{}
+	refs := map[*Element][]*prefixEntity{}
+	for _, e := range elements {
+		var prefixes []string
+		members := map[string][]Attribute{}
+		for _, a := range e.Attrs {
+			i := strings.Index(a.Name, "-")
+			if i <= 0 {
+				continue
+			}
+			prefix := a.Name[:i]
+			if members[prefix] == nil {
+				prefixes = append(prefixes, prefix)
+			}
+			members[prefix] = append(members[prefix], a)
+		}
+		for _, prefix := range prefixes {
+			attrs := members[prefix]
+			if len(attrs) < threshold {
+				continue
+			}
+			name := prefix
+			if pe := byName[name]; taken[name] || pe != nil && attrDecls(pe.attrs) != attrDecls(attrs) {
+				name = e.Name + "." + prefix
+			}
+			pe := byName[name]
+			if pe == nil {
+				pe = &prefixEntity{name: name, attrs: attrs}
+				byName[name] = pe
+				result = append(result, pe)
+			}
+			refs[e] = append(refs[e], pe)
+		}
+	}
+	return result, refs
+}
+
+// writePrefixEntity writes the declaration of pe, after the comments with
+// the targets of its IDREF attributes.
+func (o DTDOptions) writePrefixEntity(w io.Writer, pe *prefixEntity) {
+	attrs := pe.attrs
+	if o.SortEnumerations {
+		attrs = sortEnumerations(attrs)
+	}
+	for _, a := range attrs {
+		if a.Target != "" {
+			fmt.Fprintf(w, "<!-- %s -->\n", commentText(a.Name+" -> "+a.Target))
+		}
+	}
+	fmt.Fprintf(w, "<!ENTITY %% %s %s>\n", pe.name, quoteValue(attrDecls(attrs)))
+}
+
+// attrDecls renders the attribute definitions of attrs on one line.
+func attrDecls(attrs []Attribute) string {
+	decls := make([]string, len(attrs))
+	for i, a := range attrs {
+		decls[i] = a.Name + " " + dtdType(a) + " " + dtdDefault(a)
+	}
+	return strings.Join(decls, " ")
+}
+
+// withoutAttrs returns attrs without those named in drop, and the number of
+// the first own attributes left among them.
+func withoutAttrs(attrs []Attribute, own int, drop []Attribute) ([]Attribute, int) {
+	dropped := map[string]bool{}
+	for _, a := range drop {
+		dropped[a.Name] = true
+	}
+	var result []Attribute
+	left := 0
+	for i, a := range attrs {
+		if i < own && dropped[a.Name] {
+			continue
+		}
+		if i < own {
+			left++
+		}
+		result = append(result, a)
+	}
+	return result, left
+}
+
+// sortEnumerations returns a copy of attrs in which the values of each
+// enumerated or NOTATION type are sorted.
+func sortEnumerations(attrs []Attribute) []Attribute {
+	result := append([]Attribute(nil), attrs...)
+	for i, a := range result {
+		switch {
+		case isNotation(a.Type):
+			values := notationValues(a.Type)
+			sort.Strings(values)
+			result[i].Type = "NOTATION (" + strings.Join(values, "|") + ")"
+		case isEnumeration(a.Type):
+			values := enumValues(a.Type)
+			sort.Strings(values)
+			result[i].Type = "(" + strings.Join(values, "|") + ")"
+		}
+	}
+	return result
+}
+
+// writeAttlist writes the <!ATTLIST> declaration of the attributes attrs of
+// the element name, if there are any, with one attribute per line after a
+// line for each parameter entity in refs.  The target of an IDREF attribute
+// goes in a comment before the declaration, as in <!-- ref -> widget -->.
+func writeAttlist(w io.Writer, name string, attrs []Attribute, refs []string) {
+	if len(attrs) == 0 && len(refs) == 0 {
+		return
+	}
+	nameWidth, typeWidth := 0, 0
+	for _, a := range attrs {
+		if len(a.Name) > nameWidth {
+			nameWidth = len(a.Name)
+		}
+		if typ := dtdType(a); len(typ) > typeWidth {
+			typeWidth = len(typ)
+		}
+	}
+	for _, a := range attrs {
+		if a.Target != "" {
+			fmt.Fprintf(w, "<!-- %s -->\n", commentText(a.Name+" -> "+a.Target))
+		}
+	}
+	fmt.Fprintf(w, "<!ATTLIST %s\n", name)
+	for _, ref := range refs {
+		fmt.Fprintf(w, "    %%%s;\n", ref)
+	}
+	for _, a := range attrs {
+		fmt.Fprintf(w, "    %-*s %-*s %s\n", nameWidth, a.Name, typeWidth, dtdType(a), dtdDefault(a))
+	}
+	fmt.Fprintf(w, "    >\n")
+}
+
+// withXmlns returns the attributes of e followed by an #IMPLIED xmlns:prefix
+// attribute for each namespace prefix that e or its attributes use and that
+// e does not declare itself.  The reserved xml and xmlns prefixes are never
+// declared.
+func withXmlns(e *Element) []Attribute {
+	attrs := e.Attrs
+	declared := map[string]bool{"": true, "xml": true, "xmlns": true}
+	for _, a := range e.Attrs {
+		if a.Prefix() == "xmlns" {
+			declared[a.Local()] = true
+		}
+	}
+	prefixes := []string{e.Prefix()}
+	for _, a := range e.Attrs {
+		prefixes = append(prefixes, a.Prefix())
+	}
+	for _, prefix := range prefixes {
+		if !declared[prefix] {
+			declared[prefix] = true
+			attrs = append(attrs[:len(attrs):len(attrs)], Attribute{Name: "xmlns:" + prefix, Type: "CDATA", Occur: implied})
+		}
+	}
+	return attrs
+}
+
+// dtdType renders the type of a as it appears in an attribute definition.
+func dtdType(a Attribute) string {
+	return strings.TrimPrefix(a.Type, "#")
+}
+
+// dtdDefault renders the default declaration of a.  An attribute without a
+// qualifier is #IMPLIED, or has the plain default value when it has one.
+func dtdDefault(a Attribute) string {
+	switch {
+	case a.Occur == fixed:
+		return "#FIXED " + quoteValue(a.Default)
+	case a.Default != "" && a.Occur != required:
+		return quoteValue(a.Default)
+	case a.Occur == "":
+		return string(implied)
+	}
+	return string(a.Occur)
+}
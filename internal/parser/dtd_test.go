@@ -0,0 +1,702 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteDTDDocExample(t *testing.T) {
+	src := "paragraph\n" +
+		"\ttitle?\n" +
+		"\tline...+\n" +
+		"\n" +
+		"line\n" +
+		"\t(PCDATA, bold)*\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!ELEMENT paragraph (title?, line+)>\n" +
+		"<!ELEMENT title     (#PCDATA)>\n" +
+		"<!ELEMENT line      (#PCDATA, bold)*>\n" +
+		"<!ELEMENT bold      (#PCDATA)>\n"
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDAttributes(t *testing.T) {
+	root := &Element{
+		Name: "paragraph",
+		Attrs: []Attribute{
+			{Name: "id", Type: "ID", Occur: implied},
+			{Name: "name", Type: "CDATA", Occur: required},
+			{Name: "justify", Type: "(left|right|center)", Default: "left"},
+			{Name: "version", Type: "#CDATA", Occur: fixed, Default: `1.0`},
+		},
+	}
+	expect := "<!ELEMENT paragraph (#PCDATA)>\n" +
+		"<!ATTLIST paragraph\n" +
+		"    id      ID                  #IMPLIED\n" +
+		"    name    CDATA               #REQUIRED\n" +
+		"    justify (left|right|center) \"left\"\n" +
+		"    version CDATA               #FIXED \"1.0\"\n" +
+		"    >\n"
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDOnce(t *testing.T) {
+	root, err := NewParser(strings.NewReader("a\n  b\n    a...\n  b...*")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!ELEMENT a (b, b*)>\n" +
+		"<!ELEMENT b (a)>\n"
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDKeywords(t *testing.T) {
+	root, err := NewParser(strings.NewReader("doc\n  hr #EMPTY\n  wildcard #ANY")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!ELEMENT doc      (hr, wildcard)>\n" +
+		"<!ELEMENT hr       EMPTY>\n" +
+		"<!ELEMENT wildcard ANY>\n"
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDInlineContent(t *testing.T) {
+	write := func(src string) string {
+		root, err := NewParser(strings.NewReader(src)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := WriteDTD(&buf, root); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	inline := write("doc\n  title => (PCDATA, bold)*\n  para")
+	indented := write("doc\n  title\n    (PCDATA, bold)*\n  para")
+	if inline != indented {
+		t.Errorf("Expected inline content to match indented content:\n%s\nbut found:\n%s", indented, inline)
+	}
+}
+
+func TestWriteDTDAllGroups(t *testing.T) {
+	testCases := []struct {
+		content string
+		expect  string
+	}{
+		{"(b & c)", "((b, c) | (c, b))"},
+		{"(b & c? & d)*", "((b, c?, d) | (b, d, c?) | (c?, b, d) | (c?, d, b) | (d, b, c?) | (d, c?, b))*"},
+		{"(x, (b & c))", "(x, ((b, c) | (c, b)))"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.content, func(t *testing.T) {
+			root, err := NewParser(strings.NewReader("a\n  " + tC.content)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := WriteDTD(&buf, root); err != nil {
+				t.Fatal(err)
+			}
+			line := strings.SplitN(buf.String(), "\n", 2)[0]
+			if expect := "<!ELEMENT a " + tC.expect + ">"; line != expect {
+				t.Errorf("Expected %s, but found %s", expect, line)
+			}
+			if strings.Contains(buf.String(), "&") {
+				t.Errorf("Expected no & in the DTD, but found %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestWriteDTDAllGroupLimit(t *testing.T) {
+	root, err := NewParser(strings.NewReader("a\n  (b & c & d & e & f & g)")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "element a: & group of 6 members exceeds the limit of 5 for expansion"
+	if err := WriteDTD(&bytes.Buffer{}, root); err == nil || err.Error() != expect {
+		t.Errorf("Expected error %q, but found %v", expect, err)
+	}
+}
+
+func TestWriteDTDEntities(t *testing.T) {
+	src := "doc\n" +
+		"  para => (PCDATA | %inline)*\n" +
+		"  list => %items+\n" +
+		"%inline = (b | i)\n" +
+		"%items = item | %inline\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!ENTITY % inline \"b | i\">\n" +
+		"<!ENTITY % items \"(item | %inline;)\">\n" +
+		"<!ELEMENT doc  (para, list)>\n" +
+		"<!ELEMENT para (#PCDATA | %inline;)*>\n" +
+		"<!ELEMENT b    (#PCDATA)>\n" +
+		"<!ELEMENT i    (#PCDATA)>\n" +
+		"<!ELEMENT list (%items;+)>\n" +
+		"<!ELEMENT item (#PCDATA)>\n"
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDNamespaces(t *testing.T) {
+	src := "html:body xml:lang=\n" +
+		"  svg:svg xmlns:svg=#FIXED \"http://www.w3.org/2000/svg\" xlink:href=\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!ELEMENT html:body (svg:svg)>\n" +
+		"<!ELEMENT svg:svg   (#PCDATA)>\n" +
+		"<!ATTLIST html:body\n" +
+		"    xml:lang   CDATA #IMPLIED\n" +
+		"    xmlns:html CDATA #IMPLIED\n" +
+		"    >\n" +
+		"<!ATTLIST svg:svg\n" +
+		"    xmlns:svg   CDATA #FIXED \"http://www.w3.org/2000/svg\"\n" +
+		"    xlink:href  CDATA #IMPLIED\n" +
+		"    xmlns:xlink CDATA #IMPLIED\n" +
+		"    >\n"
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestCommentText(t *testing.T) {
+	for _, tC := range []struct{ text, expect string }{
+		{"a - b", "a - b"},
+		{"a -- b", "a - - b"},
+		{"---", "- - -"},
+		{"----", "- - - -"},
+	} {
+		if got := commentText(tC.text); got != tC.expect {
+			t.Errorf("%q: expected %q, but found %q", tC.text, tC.expect, got)
+		}
+	}
+
+	root, err := NewParser(strings.NewReader("doc ref=#IDREF->x---y\n  x---y\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "<!-- ref -> x- - -y -->\n") {
+		t.Errorf("Expected the target comment without --, but found\n%s", got)
+	}
+}
+
+func TestWriteDTDComments(t *testing.T) {
+	root, err := NewParser(strings.NewReader("# a -- b\n# c --- d ----\ndoc\n  title # heading\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!-- a - - b -->\n" +
+		"<!-- c - - - d - - - - -->\n" +
+		"<!ELEMENT doc   (title)>\n" +
+		"<!-- heading -->\n" +
+		"<!ELEMENT title (#PCDATA)>\n"
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDSplitAttlists(t *testing.T) {
+	src := "<!ELEMENT doc (#PCDATA)>\n" +
+		"<!ATTLIST doc id ID #IMPLIED>\n" +
+		"<!ATTLIST doc\n" +
+		"    lang  CDATA \"en\"\n" +
+		"    class CDATA #IMPLIED>\n"
+	root, err := FromDTD(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		desc   string
+		split  bool
+		expect string
+	}{
+		{"merged", false, "<!ELEMENT doc (#PCDATA)>\n" +
+			"<!ATTLIST doc\n" +
+			"    id    ID    #IMPLIED\n" +
+			"    lang  CDATA \"en\"\n" +
+			"    class CDATA #IMPLIED\n" +
+			"    >\n"},
+		{"split", true, "<!ELEMENT doc (#PCDATA)>\n" +
+			"<!ATTLIST doc\n" +
+			"    id ID #IMPLIED\n" +
+			"    >\n" +
+			"<!ATTLIST doc\n" +
+			"    lang  CDATA \"en\"\n" +
+			"    class CDATA #IMPLIED\n" +
+			"    >\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := (DTDOptions{SplitAttlists: tC.split}).WriteDTD(&buf, root); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tC.expect {
+				t.Errorf("Expected:\n%s\nbut found:\n%s", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestWriteDTDBanner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.dtdx")
+	if err := os.WriteFile(path, []byte("doc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewFileParser(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromReader, err := NewParser(strings.NewReader("doc\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	testCases := []struct {
+		desc    string
+		root    *Element
+		options DTDOptions
+		expect  string
+	}{
+		{"file", fromFile, DTDOptions{Banner: true}, "<!-- Generated from foo.dtdx by dtdx; do not edit -->\n"},
+		{"reader", fromReader, DTDOptions{Banner: true}, "<!-- Generated by dtdx; do not edit -->\n"},
+		{"timestamp", fromFile, DTDOptions{Banner: true, Timestamp: stamp}, "<!-- Generated from foo.dtdx by dtdx; do not edit -->\n" +
+			"<!-- Generated at 2024-05-06T07:08:09Z -->\n"},
+		{"none", fromFile, DTDOptions{}, ""},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tC.options.WriteDTD(&buf, tC.root); err != nil {
+				t.Fatal(err)
+			}
+			expect := tC.expect + "<!ELEMENT doc (#PCDATA)>\n"
+			if got := buf.String(); got != expect {
+				t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+			}
+		})
+	}
+}
+
+func TestWriteDTDFlatten(t *testing.T) {
+	src := "doc\n" +
+		"  para => (PCDATA | %inline)*\n" +
+		"  list => %items+\n" +
+		"  pair => (%inline, %items?)\n" +
+		"%inline = (b | i)\n" +
+		"%items = item | %inline\n"
+	inlined := "doc\n" +
+		"  para => (PCDATA | b | i)*\n" +
+		"  list => (item | b... | i...)+\n" +
+		"  pair => ((b... | i...), (item... | b... | i...)?)\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := (DTDOptions{Flatten: true}).WriteDTD(&got, root); err != nil {
+		t.Fatal(err)
+	}
+	root, err = NewParser(strings.NewReader(inlined)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := WriteDTD(&want, root); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", want.String(), got.String())
+	}
+	if strings.Contains(got.String(), "%") {
+		t.Errorf("Expected no parameter entities, but found:\n%s", got.String())
+	}
+}
+
+func TestWriteDTDSortEnumerations(t *testing.T) {
+	root, err := NewParser(strings.NewReader("img align=(top|middle|bottom) format=NOTATION(png|gif)")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		desc   string
+		sort   bool
+		expect string
+	}{
+		{"source order", false, "    align  (top|middle|bottom) #IMPLIED\n" +
+			"    format NOTATION (png|gif)  #IMPLIED\n"},
+		{"sorted", true, "    align  (bottom|middle|top) #IMPLIED\n" +
+			"    format NOTATION (gif|png)  #IMPLIED\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := (DTDOptions{SortEnumerations: tC.sort}).WriteDTD(&buf, root); err != nil {
+				t.Fatal(err)
+			}
+			expect := "<!ELEMENT img (#PCDATA)>\n<!ATTLIST img\n" + tC.expect + "    >\n"
+			if got := buf.String(); got != expect {
+				t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+			}
+		})
+	}
+	if root.Attrs[0].Type != "(top|middle|bottom)" {
+		t.Errorf("Expected the document to keep its order, but found %s", root.Attrs[0].Type)
+	}
+}
+
+func TestWriteDTDElementLess(t *testing.T) {
+	root, err := NewParser(strings.NewReader("paragraph id=\n  title?\n  line+\n    (PCDATA | bold)*\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := func(a, b *Element) bool { return a.Name < b.Name }
+	var buf bytes.Buffer
+	if err := (DTDOptions{ElementLess: byName}).WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!ELEMENT bold      (#PCDATA)>\n" +
+		"<!ELEMENT line      (#PCDATA | bold)*>\n" +
+		"<!ELEMENT paragraph (title?, line+)>\n" +
+		"<!ELEMENT title     (#PCDATA)>\n" +
+		"<!ATTLIST paragraph\n" +
+		"    id ID #IMPLIED\n" +
+		"    >\n"
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDLeaves(t *testing.T) {
+	testCases := []struct {
+		leaves LeafPlacement
+		expect string
+	}{
+		{Inline, "paragraph title line bold"},
+		{End, "paragraph line title bold"},
+		{Start, "title bold paragraph line"},
+	}
+	for _, tC := range testCases {
+		var buf bytes.Buffer
+		if err := (DTDOptions{Leaves: tC.leaves}).WriteDTD(&buf, docExample()); err != nil {
+			t.Fatal(err)
+		}
+		var order []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "<!ELEMENT" {
+				order = append(order, fields[1])
+			}
+		}
+		if got := strings.Join(order, " "); got != tC.expect {
+			t.Errorf("%d: expected %s, but found %s", tC.leaves, tC.expect, got)
+		}
+	}
+}
+
+func TestWriteDTDCollapseOptional(t *testing.T) {
+	root, err := NewParser(strings.NewReader("doc => (a?, b?, c?)*\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	options := DTDOptions{CollapseOptional: true, Warn: func(d Diagnostic) { got = append(got, d.Msg) }}
+	var buf bytes.Buffer
+	if err := options.WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<!ELEMENT doc (a | b | c)*>") {
+		t.Errorf("Expected doc to be (a | b | c)*, but found\n%s", buf.String())
+	}
+	expect := "element doc: (a?, b?, c?)* is written as (a | b | c)*, which allows its members in any order"
+	if s := strings.Join(got, "|"); s != expect {
+		t.Errorf("Expected warnings %q, but found %q", expect, s)
+	}
+
+	note, err := NewParser(strings.NewReader("note => (a?, b)*\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	buf.Reset()
+	if err := options.WriteDTD(&buf, note); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<!ELEMENT note (a?, b)*>") || len(got) > 0 {
+		t.Errorf("Expected note to keep (a?, b)* without a warning, but found %v and\n%s", got, buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<!ELEMENT doc (a?, b?, c?)*>") {
+		t.Errorf("Expected doc to keep (a?, b?, c?)* by default, but found\n%s", buf.String())
+	}
+}
+
+func TestWriteDTDFactorPrefixes(t *testing.T) {
+	const src = "doc id=#ID data-id= data-role=(main|aside) data-x=\"1\" aria-label=\n" +
+		"  p data-id= data-role=(main|aside) data-x=\"1\"\n" +
+		"  q data-id= data-role= data-x=\"1\"\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (DTDOptions{FactorPrefixes: true}).WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	expect := `<!ENTITY % data 'data-id CDATA #IMPLIED data-role (main|aside) #IMPLIED data-x CDATA "1"'>` + "\n" +
+		`<!ENTITY % q.data 'data-id CDATA #IMPLIED data-role CDATA #IMPLIED data-x CDATA "1"'>` + "\n" +
+		"<!ELEMENT doc (p, q)>\n" +
+		"<!ELEMENT p   (#PCDATA)>\n" +
+		"<!ELEMENT q   (#PCDATA)>\n" +
+		"<!ATTLIST doc\n" +
+		"    %data;\n" +
+		"    id         ID    #IMPLIED\n" +
+		"    aria-label CDATA #IMPLIED\n" +
+		"    >\n" +
+		"<!ATTLIST p\n" +
+		"    %data;\n" +
+		"    >\n" +
+		"<!ATTLIST q\n" +
+		"    %q.data;\n" +
+		"    >\n"
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected\n%s\nbut found\n%s", expect, got)
+	}
+
+	buf.Reset()
+	if err := (DTDOptions{FactorPrefixes: true, PrefixThreshold: 4}).WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); strings.Contains(got, "<!ENTITY") {
+		t.Errorf("Expected no entity below the threshold of 4, but found\n%s", got)
+	}
+}
+
+func TestGenerateBytes(t *testing.T) {
+	root := docExample()
+	root.Attrs = []Attribute{{Name: "id", Type: "ID", Occur: implied}}
+	for _, options := range []DTDOptions{{}, {Banner: true, SplitAttlists: true, Flatten: true}} {
+		var streamed bytes.Buffer
+		if err := options.WriteDTD(&streamed, root); err != nil {
+			t.Fatal(err)
+		}
+		got, err := options.GenerateBytes(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != streamed.String() {
+			t.Errorf("Expected:\n%s\nbut found:\n%s", streamed.String(), got)
+		}
+	}
+	var streamed bytes.Buffer
+	if err := WriteDTD(&streamed, root); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GenerateBytes(root); err != nil || string(got) != streamed.String() {
+		t.Errorf("Expected:\n%s\nbut found:\n%s (%v)", streamed.String(), got, err)
+	}
+	if _, err := GenerateBytes(&Element{Name: "a", Content: *group(allModelType, "", ref("b", ""), ref("c", ""), ref("d", ""), ref("e", ""), ref("f", ""), ref("g", ""))}); err == nil {
+		t.Error("Expected the error of WriteDTD, but found none")
+	}
+}
+
+func TestGenerateSplit(t *testing.T) {
+	src := "# Define paragraph element with three attributes\n" +
+		"paragraph id= name=#CDATA justify=(left|right|center)\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var elements, attlists bytes.Buffer
+	if err := GenerateSplit(root, &elements, &attlists); err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!-- Define paragraph element with three attributes -->\n" +
+		"<!ELEMENT paragraph (#PCDATA)>\n"
+	if got := elements.String(); got != expect {
+		t.Errorf("Expected elements:\n%s\nbut found:\n%s", expect, got)
+	}
+	expect = "<!ATTLIST paragraph\n" +
+		"    id      ID                  #IMPLIED\n" +
+		"    name    CDATA               #IMPLIED\n" +
+		"    justify (left|right|center) #IMPLIED\n" +
+		"    >\n"
+	if got := attlists.String(); got != expect {
+		t.Errorf("Expected attlists:\n%s\nbut found:\n%s", expect, got)
+	}
+	var whole bytes.Buffer
+	if err := WriteDTD(&whole, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := elements.String() + attlists.String(); got != whole.String() {
+		t.Errorf("Expected the parts to make up:\n%s\nbut found:\n%s", whole.String(), got)
+	}
+}
+
+func TestElementDTD(t *testing.T) {
+	src := "# The first top level definition.\n" +
+		"paragraph id= justify=(left|right)\n" +
+		"    # A definition with two references nested inside paragraph.\n" +
+		"    title?\n" +
+		"    line...+\n" +
+		"\n" +
+		"# A second top level definition.\n" +
+		"line\n" +
+		"    (#PCDATA | %inline)*\n" +
+		"%inline = bold | %more\n" +
+		"%more = em\n"
+	p := NewParser(strings.NewReader(src))
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name   string
+		expect string
+	}{
+		{"paragraph", "<!-- The first top level definition. -->\n" +
+			"<!ELEMENT paragraph (title?, line+)>\n" +
+			"<!ATTLIST paragraph\n" +
+			"    id      ID           #IMPLIED\n" +
+			"    justify (left|right) #IMPLIED\n" +
+			"    >\n"},
+		{"title", "<!-- A definition with two references nested inside paragraph. -->\n" +
+			"<!ELEMENT title (#PCDATA)>\n"},
+		{"line", "<!ENTITY % inline \"bold | %more;\">\n" +
+			"<!-- A second top level definition. -->\n" +
+			"<!ELEMENT line (#PCDATA | %inline;)*>\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.name, func(t *testing.T) {
+			got, err := p.ElementDTD(tC.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tC.expect {
+				t.Errorf("Expected:\n%s\nbut found:\n%s", tC.expect, got)
+			}
+		})
+	}
+	if _, err := p.ElementDTD("figure"); err == nil || err.Error() != "element figure is not defined" {
+		t.Errorf("Expected element figure is not defined, but found %v", err)
+	}
+}
+
+func TestOccurrenceRoundTrip(t *testing.T) {
+	testCases := []struct {
+		attr   string
+		occur  Occur
+		dflt   string
+		expect string
+	}{
+		{`x=#IMPLIED`, implied, "", `x CDATA #IMPLIED`},
+		{`x=`, implied, "", `x CDATA #IMPLIED`},
+		{`x="a"`, "", "a", `x CDATA "a"`},
+		{`x=#REQUIRED`, required, "", `x CDATA #REQUIRED`},
+		{`x=#FIXED "a"`, fixed, "a", `x CDATA #FIXED "a"`},
+		{`x=(a|b) #IMPLIED`, implied, "", `x (a|b) #IMPLIED`},
+		{`x=(a|b) "a"`, "", "a", `x (a|b) "a"`},
+		{`x=(a|b) #REQUIRED`, required, "", `x (a|b) #REQUIRED`},
+		{`x=(a|b) #FIXED "b"`, fixed, "b", `x (a|b) #FIXED "b"`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.attr, func(t *testing.T) {
+			root, err := NewParser(strings.NewReader("e " + tC.attr)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a := root.Attrs[0]; a.Occur != tC.occur || a.Default != tC.dflt {
+				t.Errorf("Expected occurrence %q and default %q, but found %q and %q", tC.occur, tC.dflt, a.Occur, a.Default)
+			}
+			var buf bytes.Buffer
+			if err := WriteDTD(&buf, root); err != nil {
+				t.Fatal(err)
+			}
+			expect := "<!ELEMENT e (#PCDATA)>\n<!ATTLIST e\n    " + tC.expect + "\n    >\n"
+			if got := buf.String(); got != expect {
+				t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+			}
+			back, err := FromDTD(strings.NewReader(buf.String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a := back.Attrs[0]; a.Occur != tC.occur || a.Default != tC.dflt {
+				t.Errorf("Expected occurrence %q and default %q back from the DTD, but found %q and %q", tC.occur, tC.dflt, a.Occur, a.Default)
+			}
+		})
+	}
+	// An attribute without a qualifier is written as #IMPLIED, or with its
+	// plain default when it has one, so "" needs no #IMPLIED in its place.
+	var unqualified, qualified bytes.Buffer
+	writeAttlist(&unqualified, "e", []Attribute{{Name: "x", Type: "CDATA"}}, nil)
+	writeAttlist(&qualified, "e", []Attribute{{Name: "x", Type: "CDATA", Occur: implied}}, nil)
+	if unqualified.String() != qualified.String() {
+		t.Errorf("Expected no qualifier to write\n%s\nbut found\n%s", qualified.String(), unqualified.String())
+	}
+	for _, src := range []string{`e x=#REQUIRED "a"`, `e x=#IMPLIED "a"`, `e x=#FIXED`} {
+		if _, err := NewParser(strings.NewReader(src)).Parse(); err == nil {
+			t.Errorf("Expected an error for %s, but found none", src)
+		}
+	}
+}
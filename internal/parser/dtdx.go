@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteDTDX writes the document rooted at root as DTDX that parses back to
+// the same document.  The parameter entities come first, then root and each
+// other definition at the top level, indented by two spaces per level, with
+// its comments on the lines above it.  An element is defined where its
+// content model first names it, unless that particle is marked as a
+// reference, and referred to as name... everywhere else.
+//
+// Content that is a sequence without a modifier is written on indented
+// lines, one particle per line, so its elements can have children of their
+// own.  Other content follows => on the definition line, where an element
+// with children or comments cannot be defined; it is referred to there and
+// defined at the top level instead.  Attributes follow the element name,
+// without their type when it is the one inferred from the name.  One with no
+// type is CDATA, which is written out when the name infers another type.
+func WriteDTDX(w io.Writer, root *Element) error {
+	return DTDXOptions{}.WriteDTDX(w, root)
+}
+
+// DTDXOptions control how DTDX is written.  The zero value writes the DTDX
+// that WriteDTDX writes.
+type DTDXOptions struct {
+	// BlankLines keeps the blank lines that the source had before each top
+	// level definition and its comments, which may be none at all, rather
+	// than one.  An element that was not parsed from DTDX has one.
+	BlankLines bool
+}
+
+// WriteDTDX writes root as the function WriteDTDX does, with the options of
+// o.
+func (o DTDXOptions) WriteDTDX(w io.Writer, root *Element) error {
+	d := &dtdxWriter{w: bufio.NewWriter(w), placed: map[*Element]bool{root: true}}
+	elements := append([]*Element{root}, root.defs...)
+	elements = append(elements, reachable(root)...)
+	entities, _ := usedEntities(elements)
+	for _, e := range entities {
+		d.w.WriteString("%" + dtdxName(e.Name) + " = " + d.content(&e.Content) + "\n")
+	}
+	for i, e := range elements {
+		if i > 0 && (d.placed[e] || e.undefined) {
+			continue
+		}
+		if i > 0 || len(entities) > 0 {
+			d.w.WriteString(strings.Repeat("\n", o.blankLines(e)))
+		}
+		d.definition(e, singleMultiplicity, 0)
+	}
+	return d.w.Flush()
+}
+
+// blankLines returns the number of blank lines to write before the top level
+// definition of e.
+func (o DTDXOptions) blankLines(e *Element) int {
+	if o.BlankLines && e.line > 0 {
+		return e.blanks
+	}
+	return 1
+}
+
+// FormatDTDX reads the DTDX document from r and writes it to w as WriteDTDX
+// does.  The separators of each group are kept, & included, since DTDX has &
+// groups even though a DTD does not.
+func FormatDTDX(w io.Writer, r io.Reader) error {
+	return DTDXOptions{}.FormatDTDX(w, r)
+}
+
+// FormatDTDX formats the DTDX document read from r as the function
+// FormatDTDX does, with the options of o.
+func (o DTDXOptions) FormatDTDX(w io.Writer, r io.Reader) error {
+	root, err := NewParser(r).Parse()
+	if err != nil {
+		return err
+	}
+	return o.WriteDTDX(w, root)
+}
+
+// dtdxWriter writes DTDX, keeping track of the elements whose definitions
+// have been written.
+type dtdxWriter struct {
+	w      *bufio.Writer
+	placed map[*Element]bool
+}
+
+// definition writes the definition of e on its own line at the given depth,
+// and its children on the lines after it.
+func (d *dtdxWriter) definition(e *Element, m multiplicity, depth int) {
+	d.placed[e] = true
+	indent := strings.Repeat("  ", depth)
+	for _, line := range e.Doc {
+		d.w.WriteString(strings.TrimRight(indent+"# "+line, " ") + "\n")
+	}
+	keys := make([]string, 0, len(e.Docs))
+	for key := range e.Docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		d.w.WriteString(strings.TrimRight(indent+"# @"+key+": "+e.Docs[key], " ") + "\n")
+	}
+	d.w.WriteString(indent + d.head(e, m))
+	c := &e.Content
+	switch {
+	case isSimple(c):
+	case c.multiplicity == singleMultiplicity && (c.modelType == groupModelType || c.modelType == sequenceModelType):
+		d.w.WriteString("\n")
+		for _, child := range c.children {
+			d.line(child, depth+1)
+		}
+		return
+	case c.modelType == elementModelType || c.modelType == entityModelType:
+		d.w.WriteString("\n")
+		d.line(c, depth+1)
+		return
+	default:
+		d.w.WriteString(" => " + d.content(c))
+	}
+	d.w.WriteString("\n")
+}
+
+// line writes the particle c of indented content on its own line.
+func (d *dtdxWriter) line(c *ContentModel, depth int) {
+	if c.modelType == elementModelType && d.definesHere(c) {
+		d.definition(c.element, c.multiplicity, depth)
+		return
+	}
+	d.w.WriteString(strings.Repeat("  ", depth) + d.particle(c) + "\n")
+}
+
+// content renders c as the content after => or in an entity definition.  A
+// group of one unmodified particle needs no parentheses.
+func (d *dtdxWriter) content(c *ContentModel) string {
+	switch {
+	case c.modelType == groupModelType && len(c.children) == 1 && c.multiplicity == singleMultiplicity:
+		return d.particle(c.children[0])
+	case c.modelType == pcdataModelType:
+		return "(PCDATA)" + string(c.multiplicity)
+	}
+	return d.particle(c)
+}
+
+// particle renders c where it shares its line with other particles, so an
+// element can be defined there only when it has no children or comments.
+func (d *dtdxWriter) particle(c *ContentModel) string {
+	m := string(c.multiplicity)
+	switch c.modelType {
+	case pcdataModelType:
+		return "PCDATA" + m
+	case elementModelType:
+		if e := c.element; d.definesHere(c) && isSimple(&e.Content) && len(e.Doc) == 0 && len(e.Docs) == 0 {
+			d.placed[e] = true
+			return d.head(e, c.multiplicity)
+		}
+		return dtdxName(c.element.Name) + "..." + m
+	case entityModelType:
+		return "%" + dtdxName(c.entity.Name) + m
+	}
+	members := make([]string, len(c.children))
+	for i, child := range c.children {
+		members[i] = d.particle(child)
+	}
+	return "(" + strings.Join(members, getSep(c.modelType)) + ")" + m
+}
+
+// definesHere reports whether the element particle c is where its element
+// is to be defined.
+func (d *dtdxWriter) definesHere(c *ContentModel) bool {
+	return !c.reference && !d.placed[c.element] && !c.element.undefined
+}
+
+// head renders the definition line of e up to its content: the name, the
+// multiplicity of its particle, the attributes and an #EMPTY or #ANY.
+func (d *dtdxWriter) head(e *Element, m multiplicity) string {
+	var result strings.Builder
+	result.WriteString(dtdxName(e.Name) + string(m))
+	for _, a := range e.Attrs {
+		result.WriteString(" " + dtdxName(a.Name) + "=")
+		sep := " " // between the type and the default
+		switch {
+		case isNotation(a.Type):
+			result.WriteString("NOTATION" + strings.TrimSpace(a.Type[len("NOTATION"):]))
+		case isEnumeration(a.Type):
+			result.WriteString(a.Type)
+		case a.Target != "":
+			result.WriteString("#" + strings.TrimPrefix(a.Type, "#") + "->" + dtdxName(a.Target))
+		case a.Type != "" && a.Type != inferType(a.Name):
+			result.WriteString("#" + strings.TrimPrefix(a.Type, "#"))
+		case a.Type == "" && inferType(a.Name) != "CDATA":
+			result.WriteString("#CDATA")
+		default:
+			sep = ""
+		}
+		switch a.Occur {
+		case required:
+			result.WriteString(sep + "#REQUIRED")
+		case fixed:
+			result.WriteString(sep + "#FIXED " + dtdxQuote(a.Default))
+		default:
+			if a.Default != "" {
+				result.WriteString(sep + dtdxQuote(a.Default))
+			}
+		}
+	}
+	switch e.Content.modelType {
+	case emptyModelType:
+		result.WriteString(" #EMPTY")
+	case anyModelType:
+		result.WriteString(" #ANY")
+	}
+	return result.String()
+}
+
+// isSimple reports whether the content model c is written without content
+// after the definition line: (#PCDATA), the default, or EMPTY or ANY.
+func isSimple(c *ContentModel) bool {
+	switch c.modelType {
+	case unknownModelType, emptyModelType, anyModelType:
+		return true
+	case pcdataModelType:
+		return c.multiplicity == singleMultiplicity
+	}
+	return false
+}
+
+// dtdxName escapes each # in name, which would otherwise start a comment.
+func dtdxName(name string) string {
+	return strings.ReplaceAll(name, "#", `\#`)
+}
+
+// dtdxQuote renders s as a double quoted value.
+func dtdxQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
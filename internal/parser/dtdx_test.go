@@ -0,0 +1,224 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// roundTrip writes root as DTDX, parses the result, and checks that the
+// document it parses to writes the same DTD and the same DTDX.
+func roundTrip(t *testing.T, root *Element) string {
+	t.Helper()
+	var dtdx, want bytes.Buffer
+	if err := WriteDTDX(&dtdx, root); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteDTD(&want, root); err != nil {
+		t.Fatal(err)
+	}
+	back, err := NewParser(strings.NewReader(dtdx.String())).Parse()
+	if err != nil {
+		t.Fatalf("%v in:\n%s", err, dtdx.String())
+	}
+	var again, got bytes.Buffer
+	if err := WriteDTDX(&again, back); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteDTD(&got, back); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Expected the DTD:\n%s\nbut found:\n%s", want.String(), got.String())
+	}
+	if again.String() != dtdx.String() {
+		t.Errorf("Expected to write again:\n%s\nbut found:\n%s", dtdx.String(), again.String())
+	}
+	return dtdx.String()
+}
+
+func TestWriteDTDX(t *testing.T) {
+	src := "# The whole document.\n" +
+		"doc   id=  kind=(a|b) #REQUIRED\n" +
+		"    title? lang=\"en\"  version=#FIXED \"1\"\n" +
+		"    (para... | list...)+\n" +
+		"para => (PCDATA | %inline)*\n" +
+		"%inline = (bold | italic)\n" +
+		"list\n" +
+		"    item* ref=#IDREF note=\"say \\\"hi\\\"\"\n" +
+		"        list...?\n" +
+		"    hr #EMPTY   # a rule\n" +
+		"    lnie...\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `%inline = (bold | italic)
+
+# The whole document.
+doc id= kind=(a|b) #REQUIRED
+  title? lang="en" version=#FIXED "1"
+  (para... | list...)+
+
+para => (PCDATA | %inline)*
+
+list
+  item* ref=#IDREF note="say \"hi\""
+    list...?
+  # a rule
+  hr #EMPTY
+  lnie...
+`
+	if got := roundTrip(t, root); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDXFromDTD(t *testing.T) {
+	src := "<!ELEMENT doc (head, (para | list)*)>\n" +
+		"<!ATTLIST doc id CDATA #IMPLIED>\n" +
+		"<!ELEMENT head (#PCDATA)>\n" +
+		"<!ELEMENT para (#PCDATA | em)*>\n" +
+		"<!ELEMENT list (item+)>\n" +
+		"<!ELEMENT item (para)>\n" +
+		"<!ELEMENT em (#PCDATA)>\n"
+	root, err := FromDTD(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `doc id=#CDATA
+  head
+  (para... | list...)*
+
+para => (PCDATA | em)*
+
+list
+  item+
+    para...
+`
+	if got := roundTrip(t, root); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDXFromDTDEnumeration(t *testing.T) {
+	src := "<!ELEMENT img EMPTY>\n" +
+		"<!ATTLIST img\n" +
+		"    size  (1|2)   \"1\"\n" +
+		"    scale (0.5|1) #REQUIRED\n" +
+		"    id    ID      #IMPLIED\n" +
+		"    >\n"
+	root, err := FromDTD(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `img size=(1|2) "1" scale=(0.5|1) #REQUIRED id= #EMPTY
+`
+	if got := roundTrip(t, root); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDXUntyped(t *testing.T) {
+	e := &Element{Name: "e", Attrs: []Attribute{{Name: "id"}, {Name: "idref", Default: "x"}, {Name: "title"}}}
+	var buf bytes.Buffer
+	if err := WriteDTDX(&buf, e); err != nil {
+		t.Fatal(err)
+	}
+	expect := "e id=#CDATA idref=#CDATA \"x\" title=\n"
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+	back, err := NewParser(strings.NewReader(buf.String())).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range back.Attrs {
+		if a.Type != "CDATA" {
+			t.Errorf("Expected attribute %s to be CDATA, but found %s", a.Name, a.Type)
+		}
+	}
+}
+
+func TestWriteDTDXNotation(t *testing.T) {
+	e := &Element{Name: "img", Attrs: []Attribute{{Name: "format", Type: "NOTATION (gif|png)", Occur: implied}}}
+	expect := "img format=NOTATION(gif|png)\n"
+	if got := roundTrip(t, e); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteDTDXTarget(t *testing.T) {
+	e := &Element{Name: "a", Attrs: []Attribute{{Name: "idref", Type: "IDREF", Occur: implied, Target: "widget"}}}
+	expect := "a idref=#IDREF->widget\n"
+	if got := roundTrip(t, e); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestFormatDTDX(t *testing.T) {
+	src := "doc\n" +
+		"  head => (title & meta*)\n" +
+		"  (para | list...)*\n" +
+		"list => item+, hr?\n"
+	expect := "doc\n" +
+		"  head => (title & meta*)\n" +
+		"  (para | list...)*\n" +
+		"\n" +
+		"list\n" +
+		"  item+\n" +
+		"  hr?\n"
+	var buf bytes.Buffer
+	if err := FormatDTDX(&buf, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+	if err := FormatDTDX(&buf, strings.NewReader("a\n  (b")); err == nil {
+		t.Errorf("Expected a document that does not parse to be an error")
+	}
+}
+
+func TestFormatDTDXBlankLines(t *testing.T) {
+	src := "doc\n" +
+		"  para...+\n" +
+		"\n" +
+		"\n" +
+		"# Paragraphs.\n" +
+		"para => (PCDATA | b... | i...)*\n" +
+		"b id=\n" +
+		"\n" +
+		"i #EMPTY\n"
+	testCases := []struct {
+		desc    string
+		options DTDXOptions
+		expect  string
+	}{
+		{"kept", DTDXOptions{BlankLines: true}, src},
+		{"one", DTDXOptions{}, "doc\n" +
+			"  para...+\n" +
+			"\n" +
+			"# Paragraphs.\n" +
+			"para => (PCDATA | b... | i...)*\n" +
+			"\n" +
+			"b id=\n" +
+			"\n" +
+			"i #EMPTY\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tC.options.FormatDTDX(&buf, strings.NewReader(src)); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tC.expect {
+				t.Errorf("Expected:\n%s\nbut found:\n%s", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestWriteDTDXDocExample(t *testing.T) {
+	roundTrip(t, docExample())
+}
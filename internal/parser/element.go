@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bytes"
+	"strings"
 )
 
 // Elements and Attributes are fundamental components of schemas for XML.
@@ -10,17 +11,44 @@ import (
 
 // Element represents an Element definition.
 type Element struct {
-	Name    string       // name of the element (future: qname)
-	Attrs   []Attribute  // the elements Attribute list
-	Content ContentModel // content model
+	Name    string            // name of the element, possibly a qname like html:body
+	Attrs   []Attribute       // the elements Attribute list
+	Content ContentModel      // content model
+	Doc     []string          // comments on the definition, one per line
+	Docs    map[string]string // structured comments like # @desc: text, by key
+	DefPos  Position          // span of the definition in its source, if parsed
+
+	line, col int        // position of the definition, or first reference
+	undefined bool       // referenced but never defined
+	defs      []*Element // of a root: the definitions of its document
+	source    string     // of a root: the file it was parsed from, if known
+	blanks    int        // blank lines before the definition and its comments
+}
+
+// Position is a span of source text: the line and column of its first
+// character and those just past its last, all counted from 1.
+type Position struct {
+	Line, Col       int
+	EndLine, EndCol int
+}
+
+// Entity represents a parameter entity: a named content model fragment that
+// the content of elements can refer to.
+type Entity struct {
+	Name    string       `json:"name"`    // name of the entity, without the %
+	Content ContentModel `json:"content"` // the fragment the name stands for
+
+	line, col int // position of the definition, or first reference
 }
 
 // ContentModel is either a content model or content model fragment
 type ContentModel struct {
-	children     []*ContentModel // non-nil for groups
+	children     []*ContentModel // non-nil for groups; the content of entity
 	element      *Element        // non-nil for elementModelType
+	entity       *Entity         // non-nil for entityModelType
 	modelType    modelType
 	multiplicity multiplicity
+	reference    bool // an element written as name..., not its definition
 }
 
 // modelType identifies the type of content model fragment
@@ -34,6 +62,9 @@ const (
 	sequenceModelType           // (,)
 	choiceModelType             // (|)
 	allModelType                // (&) - not supported by XML DTD's
+	emptyModelType              // EMPTY
+	anyModelType                // ANY
+	entityModelType             // %name
 )
 
 // multiplicity of the model fragment
@@ -46,6 +77,28 @@ const (
 	oneOrMoreMultiplicity  = "+"
 )
 
+// Prefix returns the namespace prefix of the element name, or "" if the name
+// has none.
+func (e *Element) Prefix() string {
+	prefix, _ := splitQName(e.Name)
+	return prefix
+}
+
+// Local returns the element name without its namespace prefix.
+func (e *Element) Local() string {
+	_, local := splitQName(e.Name)
+	return local
+}
+
+// splitQName splits a qualified name such as html:body at its colon into the
+// prefix and the local part.  A name without a colon has no prefix.
+func splitQName(name string) (prefix, local string) {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
 // Convert the content model to a string
 func (c *ContentModel) String() string {
 	if c == nil {
@@ -60,21 +113,26 @@ func baseString(c *ContentModel) string {
 		return "(#PCDATA)"
 	case elementModelType:
 		return c.element.Name
+	case emptyModelType:
+		return "EMPTY"
+	case anyModelType:
+		return "ANY"
+	case entityModelType:
+		return "%" + c.entity.Name + ";"
 	case groupModelType:
 		if len(c.children) == 1 {
-			return "(" + c.children[0].String() + ")"
+			return "(" + childString(c.children[0]) + ")"
 		}
 		fallthrough
-	case choiceModelType:
-	case allModelType:
-	case sequenceModelType:
+	case choiceModelType, allModelType, sequenceModelType:
 		var result bytes.Buffer
 		sep := getSep(c.modelType)
 		result.WriteRune('(')
-		result.WriteString(c.children[0].String())
-		for i := 1; i < len(c.children); i++ {
-			result.WriteString(sep)
-			result.WriteString(c.children[i].String())
+		for i, child := range c.children {
+			if i > 0 {
+				result.WriteString(sep)
+			}
+			result.WriteString(childString(child))
 		}
 		result.WriteRune(')')
 		return result.String()
@@ -82,6 +140,15 @@ func baseString(c *ContentModel) string {
 	return "EMPTY"
 }
 
+// childString converts a member of a group, where #PCDATA is not in its own
+// parentheses, to a string.
+func childString(c *ContentModel) string {
+	if c.modelType == pcdataModelType {
+		return "#PCDATA" + string(c.multiplicity)
+	}
+	return c.String()
+}
+
 func getSep(mt modelType) string {
 	switch mt {
 	case choiceModelType:
@@ -91,3 +158,161 @@ func getSep(mt modelType) string {
 	}
 	return ", "
 }
+
+// IsEmptyAllowed reports whether the content model of e permits an instance
+// with no children, because every particle is optional or repeatable.
+func (e *Element) IsEmptyAllowed() bool {
+	return e.Content.nullable()
+}
+
+// nullable reports whether the content model fragment can match nothing.
+func (c *ContentModel) nullable() bool {
+	if c == nil {
+		return true
+	}
+	switch c.multiplicity {
+	case optionalMultiplicity, zeroOrMoreMultiplicity:
+		return true
+	}
+	switch c.modelType {
+	case elementModelType:
+		return false
+	case choiceModelType:
+		for _, child := range c.children {
+			if child.nullable() {
+				return true
+			}
+		}
+		return false
+	case groupModelType, sequenceModelType, allModelType, entityModelType:
+		for _, child := range c.children {
+			if !child.nullable() {
+				return false
+			}
+		}
+	}
+	return true // #PCDATA or the (#PCDATA) default
+}
+
+// EBNF renders the content model of e as an EBNF production, where [ x ]
+// is optional, { x } repeats zero or more times, and parts of a sequence are
+// separated by spaces.  For example (title?, line+) renders as
+//
+//	paragraph = [ title ] line { line }
+func (e *Element) EBNF() string {
+	return e.Name + " = " + e.Content.ebnf(false)
+}
+
+// ebnf renders a content model fragment.  A group of several particles is
+// parenthesized when it is nested in another group, unless brackets or
+// braces already delimit it.
+func (c *ContentModel) ebnf(nested bool) string {
+	var body string
+	compound := false
+	switch c.modelType {
+	case unknownModelType, pcdataModelType:
+		body = "#PCDATA"
+	case elementModelType:
+		body = c.element.Name
+	case emptyModelType:
+		body = "EMPTY"
+	case anyModelType:
+		body = "ANY"
+	case entityModelType:
+		if len(c.children) == 0 {
+			body = "%" + c.entity.Name
+			break
+		}
+		body = c.children[0].ebnf(true)
+	default:
+		sep := " "
+		switch c.modelType {
+		case choiceModelType:
+			sep = " | "
+		case allModelType:
+			sep = " & "
+		}
+		parts := make([]string, len(c.children))
+		for i, child := range c.children {
+			parts[i] = child.ebnf(len(c.children) > 1)
+		}
+		body = strings.Join(parts, sep)
+		compound = len(c.children) > 1
+	}
+	switch c.multiplicity {
+	case optionalMultiplicity:
+		return "[ " + body + " ]"
+	case zeroOrMoreMultiplicity:
+		return "{ " + body + " }"
+	case oneOrMoreMultiplicity:
+		if compound {
+			return "( " + body + " ) { " + body + " }"
+		}
+		return body + " { " + body + " }"
+	}
+	if compound && nested {
+		return "( " + body + " )"
+	}
+	return body
+}
+
+// Tree renders e as an indented tree for debugging: the element name, then
+// its attributes prefixed by @, then its content model.  Each element is
+// expanded the first time it appears; later appearances are shown as a
+// name... reference, so recursive models print in finite space.
+func (e *Element) Tree() string {
+	var result bytes.Buffer
+	seen := map[*Element]bool{}
+	var element func(e *Element, suffix, indent string)
+	var content func(c *ContentModel, indent string)
+	element = func(e *Element, suffix, indent string) {
+		if seen[e] {
+			result.WriteString(indent + e.Name + "..." + suffix + "\n")
+			return
+		}
+		seen[e] = true
+		result.WriteString(indent + e.Name + suffix + "\n")
+		for _, a := range e.Attrs {
+			occur := a.Occur
+			if occur == "" {
+				occur = implied
+			}
+			result.WriteString(indent + "  @" + a.Name + " " + a.Type + " " + string(occur))
+			if a.Default != "" {
+				result.WriteString(" " + quoteValue(a.Default))
+			}
+			result.WriteString("\n")
+		}
+		content(&e.Content, indent+"  ")
+	}
+	content = func(c *ContentModel, indent string) {
+		suffix := string(c.multiplicity)
+		switch c.modelType {
+		case unknownModelType, pcdataModelType:
+			result.WriteString(indent + "#PCDATA" + suffix + "\n")
+		case elementModelType:
+			element(c.element, suffix, indent)
+		case entityModelType:
+			result.WriteString(indent + "%" + c.entity.Name + suffix + "\n")
+			if len(c.children) > 0 {
+				content(c.children[0], indent+"  ")
+			}
+		default:
+			result.WriteString(indent + treeLabels[c.modelType] + suffix + "\n")
+			for _, child := range c.children {
+				content(child, indent+"  ")
+			}
+		}
+	}
+	element(e, "", "")
+	return result.String()
+}
+
+var treeLabels = map[modelType]string{
+	groupModelType:    "group",
+	sequenceModelType: "sequence",
+	choiceModelType:   "choice",
+	allModelType:      "all",
+	emptyModelType:    "EMPTY",
+	anyModelType:      "ANY",
+}
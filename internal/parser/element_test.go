@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"io"
+	"testing"
+)
+
+// ref builds an element particle for tests.
+func ref(name string, m multiplicity) *ContentModel {
+	return &ContentModel{modelType: elementModelType, element: &Element{Name: name}, multiplicity: m}
+}
+
+// group builds a content group of the given type for tests.
+func group(mt modelType, m multiplicity, children ...*ContentModel) *ContentModel {
+	return &ContentModel{modelType: mt, multiplicity: m, children: children}
+}
+
+func TestIsEmptyAllowed(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		content *ContentModel
+		expect  bool
+	}{
+		{"(a?, b?)", group(sequenceModelType, "", ref("a", "?"), ref("b", "?")), true},
+		{"(a, b)", group(sequenceModelType, "", ref("a", ""), ref("b", "")), false},
+		{"(a|b)*", group(choiceModelType, "*", ref("a", ""), ref("b", "")), true},
+		{"(a|b+)", group(choiceModelType, "", ref("a", ""), ref("b", "+")), false},
+		{"(a|b?)", group(choiceModelType, "", ref("a", ""), ref("b", "?")), true},
+		{"(a+)", group(groupModelType, "", ref("a", "+")), false},
+		{"(#PCDATA)", &ContentModel{modelType: pcdataModelType}, true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			e := Element{Name: "e", Content: *tC.content}
+			if got := e.IsEmptyAllowed(); got != tC.expect {
+				t.Errorf("Expected %v, but found %v", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestEBNF(t *testing.T) {
+	testCases := []struct {
+		content *ContentModel
+		expect  string
+	}{
+		{group(sequenceModelType, "", ref("title", "?"), ref("line", "+")), "e = [ title ] line { line }"},
+		{group(sequenceModelType, "*", &ContentModel{modelType: pcdataModelType}, ref("bold", "")), "e = { #PCDATA bold }"},
+		{group(choiceModelType, "", ref("a", ""), ref("b", "")), "e = a | b"},
+		{group(choiceModelType, "+", ref("a", ""), ref("b", "")), "e = ( a | b ) { a | b }"},
+		{group(sequenceModelType, "", ref("a", ""), group(choiceModelType, "", ref("b", ""), ref("c", ""))), "e = a ( b | c )"},
+		{group(sequenceModelType, "", ref("a", ""), group(choiceModelType, "?", ref("b", ""), ref("c", ""))), "e = a [ b | c ]"},
+		{group(sequenceModelType, "+", ref("a", ""), ref("b", "")), "e = ( a b ) { a b }"},
+		{&ContentModel{}, "e = #PCDATA"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.expect, func(t *testing.T) {
+			e := Element{Name: "e", Content: *tC.content}
+			if got := e.EBNF(); got != tC.expect {
+				t.Errorf("Expected [%s], but found [%s]", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	root := docExample()
+	root.Attrs = []Attribute{{Name: "id", Type: "ID", Occur: implied}, {Name: "lang", Type: "CDATA", Default: "en"}}
+	line := root.Content.children[1].element
+	root.Content.children = append(root.Content.children, &ContentModel{modelType: elementModelType, element: line})
+	expect := `paragraph
+  @id ID #IMPLIED
+  @lang CDATA #IMPLIED "en"
+  sequence
+    title?
+      #PCDATA
+    line+
+      sequence*
+        #PCDATA
+        bold
+          #PCDATA
+    line...
+`
+	if got := root.Tree(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestEmptyGroupAndEntity(t *testing.T) {
+	entity := &ContentModel{modelType: entityModelType, entity: &Entity{Name: "x"}}
+	testCases := []struct {
+		content *ContentModel
+		expect  string
+	}{
+		{group(groupModelType, ""), "()"},
+		{group(choiceModelType, "*"), "()*"},
+		{entity, "%x;"},
+		{group(choiceModelType, "*", &ContentModel{modelType: pcdataModelType}, entity), "(#PCDATA | %x;)*"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.expect, func(t *testing.T) {
+			e := &Element{Name: "e", Content: *tC.content}
+			if got := e.Content.String(); got != tC.expect {
+				t.Errorf("Expected [%s], but found [%s]", tC.expect, got)
+			}
+			e.EBNF()
+			e.Tree()
+			e.Check()
+			if err := GenerateHTMLDocs(e, io.Discard); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
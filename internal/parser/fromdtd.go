@@ -0,0 +1,343 @@
+package parser
+
+import (
+	"io"
+	"unicode"
+
+	"github.com/adobrowolski/dtdx/internal/lexer"
+)
+
+// Lexical types used only in XML DTDs.  The other tokens of a DTD reuse the
+// DTDX types: names are identifierTok, #PCDATA and #REQUIRED are
+// directiveTok, and literals are quoteTok.
+const (
+	declTok    lexer.TokenType = iota + targetTok + 1 // <!ELEMENT and the like
+	declEndTok                                        // >
+)
+
+func init() {
+	lexer.TokenName[declTok] = "declTok"
+	lexer.TokenName[declEndTok] = "declEndTok"
+}
+
+// FromDTD reads the <!ELEMENT> and <!ATTLIST> declarations of an XML DTD and
+// returns the root of the same structure Parse builds for the DTDX document
+// that a DTD is written from.  Other declarations, comments and processing
+// instructions are skipped, and a parameter entity reference is an error.
+//
+// The root is the first declared element that no other element refers to,
+// or the first declared element when every one is referred to.  Each element
+// is defined under the first element that reaches it from the root, and the
+// content models that reach it again, including cycles, refer to it as
+// name....  An element the root does not reach becomes another top level
+// definition, and one that is never declared has (#PCDATA) content.  The
+// attributes of an element may come from several <!ATTLIST> declarations,
+// which DTDOptions.SplitAttlists writes back separately.
+func FromDTD(r io.Reader) (*Element, error) {
+	p := &Parser{}
+	p.reset(r, DTDState)
+	p.s.State = p.scanState()
+
+	for {
+		var err error
+		switch tok, lit := p.scan(); {
+		case tok == declTok && lit == "ELEMENT":
+			err = p.elementDecl()
+		case tok == declTok && lit == "ATTLIST":
+			err = p.attlistDecl()
+		case tok == declTok:
+			err = p.skipDecl()
+		case tok == eofTok:
+			if len(p.order) == 0 {
+				return nil, p.unexpected(tok, lit, "element declaration")
+			}
+			return p.nest(), nil
+		default:
+			err = p.unexpected(tok, lit, "declaration")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// elementDecl parses an element declaration after its <!ELEMENT.
+func (p *Parser) elementDecl() error {
+	tok, name := p.scan()
+	if tok != identifierTok {
+		return p.unexpected(tok, name, "element name")
+	}
+	if _, ok := p.elements[name]; ok {
+		return p.errorf(DuplicateElement, name)
+	}
+	line, col := p.pos()
+	e := p.reference(name, line, col)
+	delete(p.refs, name)
+	e.line, e.col = line, col
+	p.elements[name] = e
+	p.order = append(p.order, name)
+
+	switch tok, lit := p.scan(); {
+	case tok == identifierTok && lit == "EMPTY":
+		e.Content = ContentModel{modelType: emptyModelType}
+	case tok == identifierTok && lit == "ANY":
+		e.Content = ContentModel{modelType: anyModelType}
+	case tok == openTok:
+		c, err := p.dtdGroup()
+		if err != nil {
+			return err
+		}
+		c.multiplicity = p.modifier()
+		if len(c.children) == 1 && c.children[0].modelType == pcdataModelType && c.multiplicity == singleMultiplicity {
+			c = c.children[0] // (#PCDATA) is the default content
+		}
+		e.Content = *c
+	default:
+		return p.unexpected(tok, lit, "content model")
+	}
+	if tok, lit := p.scan(); tok != declEndTok {
+		return p.unexpected(tok, lit, "'>'")
+	}
+	return nil
+}
+
+// dtdGroup parses a parenthesized group of a content model after its '('.
+// Unlike content in DTDX, every name in a DTD refers to an element.
+func (p *Parser) dtdGroup() (*ContentModel, error) {
+	g := &ContentModel{modelType: groupModelType}
+	sep := ""
+	for {
+		var c *ContentModel
+		switch tok, lit := p.scan(); {
+		case tok == directiveTok && lit == "#PCDATA":
+			c = &ContentModel{modelType: pcdataModelType}
+		case tok == identifierTok:
+			line, col := p.pos()
+			c = &ContentModel{modelType: elementModelType, element: p.reference(lit, line, col)}
+		case tok == openTok:
+			var err error
+			if c, err = p.dtdGroup(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.unexpected(tok, lit, "element name or group")
+		}
+		c.multiplicity = p.modifier()
+		g.children = append(g.children, c)
+
+		switch tok, lit := p.scan(); {
+		case tok == closeTok:
+			g.join(sep)
+			return g, nil
+		case tok == separatorTok && lit != "&":
+			if sep != "" && sep != lit {
+				return nil, p.errorf(MixedSeparators, lit, sep)
+			}
+			sep = lit
+		default:
+			return nil, p.unexpected(tok, lit, "separator or ')'")
+		}
+	}
+}
+
+// attlistDecl parses an attribute list declaration after its <!ATTLIST.  The
+// element it names need not be declared yet.
+func (p *Parser) attlistDecl() error {
+	tok, name := p.scan()
+	if tok != identifierTok {
+		return p.unexpected(tok, name, "element name")
+	}
+	line, col := p.pos()
+	e := p.elements[name]
+	if e == nil {
+		e = p.reference(name, line, col)
+	}
+	block := 0
+	if n := len(e.Attrs); n > 0 {
+		block = e.Attrs[n-1].block + 1
+	}
+	for {
+		tok, lit := p.scan()
+		switch tok {
+		case declEndTok:
+			return nil
+		case identifierTok:
+		default:
+			return p.unexpected(tok, lit, "attribute name or '>'")
+		}
+		a := Attribute{Name: lit, Occur: implied, block: block}
+		switch tok, lit := p.scan(); {
+		case tok == identifierTok && lit == "NOTATION":
+			if tok, lit := p.scan(); tok != openTok {
+				return p.unexpected(tok, lit, "'(' after NOTATION")
+			}
+			typ, err := p.enumeration()
+			if err != nil {
+				return err
+			}
+			a.Type = "NOTATION " + typ
+		case tok == identifierTok:
+			a.Type = lit
+		case tok == openTok:
+			typ, err := p.enumeration()
+			if err != nil {
+				return err
+			}
+			a.Type = typ
+		default:
+			return p.unexpected(tok, lit, "attribute type")
+		}
+		if err := p.occurrence(&a); err != nil {
+			return err
+		}
+		if err := e.AddAttribute(a); err != nil {
+			return p.positioned(err.Error())
+		}
+	}
+}
+
+// skipDecl skips the rest of a declaration FromDTD does not read, such as
+// <!ENTITY or <!NOTATION.
+func (p *Parser) skipDecl() error {
+	for {
+		switch tok, lit := p.scan(); tok {
+		case declEndTok:
+			return nil
+		case eofTok, lexer.ErrorTok:
+			return p.unexpected(tok, lit, "'>'")
+		}
+	}
+}
+
+// nest picks the root of the declared elements and decides where each is
+// defined, marking the other content model particles as references.
+func (p *Parser) nest() *Element {
+	for _, e := range p.refs {
+		e.Content = ContentModel{modelType: pcdataModelType}
+		e.undefined = true
+	}
+	referenced := map[*Element]bool{}
+	for _, name := range p.order {
+		e := p.elements[name]
+		for _, child := range e.Content.elements() {
+			if child != e {
+				referenced[child] = true
+			}
+		}
+	}
+	root := p.elements[p.order[0]]
+	for _, name := range p.order {
+		if e := p.elements[name]; !referenced[e] {
+			root = e
+			break
+		}
+	}
+
+	placed := map[*Element]bool{}
+	var place func(e *Element)
+	var walk func(c *ContentModel)
+	place = func(e *Element) {
+		placed[e] = true
+		root.defs = append(root.defs, e)
+		walk(&e.Content)
+	}
+	walk = func(c *ContentModel) {
+		if c.modelType == elementModelType {
+			if placed[c.element] || c.element.undefined {
+				c.reference = true
+			} else {
+				place(c.element)
+			}
+			return
+		}
+		for _, child := range c.children {
+			walk(child)
+		}
+	}
+	place(root)
+	for _, name := range p.order {
+		if e := p.elements[name]; !placed[e] {
+			place(e)
+		}
+	}
+	return root
+}
+
+// DTDState scans the declarations of an XML DTD.  Whitespace, comments and
+// processing instructions are ignored.
+func DTDState(l *lexer.Lex) lexer.StateFunc {
+	for {
+		switch {
+		case l.LookingAt("<!--"):
+			skipPast(l, "-->")
+			continue
+		case l.LookingAt("<?"):
+			skipPast(l, "?>")
+			continue
+		case l.LookingAt("<!"):
+			l.Next()
+			l.Next()
+			l.AcceptRun(uppercase)
+			l.EmitValue(declTok, l.Current()[2:])
+			continue
+		}
+		r := l.Next()
+		if t, ok := singleChars.Lookup(r); ok {
+			l.Emit(t)
+			continue
+		}
+		switch {
+		case unicode.IsSpace(r):
+			l.Ignore()
+		case r == '>':
+			l.Emit(declEndTok)
+		case r == '"' || r == '\'':
+			return dtdLiteral(l, r)
+		case r == '#':
+			l.AcceptRun(uppercase)
+			l.Emit(directiveTok)
+		case r == '%':
+			for isNameChar(l.Next()) {
+			}
+			l.Backup()
+			l.Accept(";")
+			l.Emit(entityTok)
+		case isNameChar(r):
+			for isNameChar(l.Next()) {
+			}
+			l.Backup()
+			l.Emit(identifierTok)
+		case r == lexer.EOFRune:
+			l.Emit(eofTok)
+			return nil
+		default:
+			return scanErrorf(l, UnexpectedChar, r)
+		}
+	}
+}
+
+// dtdLiteral scans a quoted literal after its opening quote and emits its
+// text, which may span lines.
+func dtdLiteral(l *lexer.Lex, quote rune) lexer.StateFunc {
+	for {
+		switch l.Next() {
+		case quote:
+			value := l.Current()
+			l.EmitValue(quoteTok, value[1:len(value)-1])
+			return DTDState
+		case lexer.EOFRune:
+			return scanErrorf(l, QuoteEOF, l.Current())
+		}
+	}
+}
+
+// skipPast ignores the input up to and including end, or to the end of input.
+func skipPast(l *lexer.Lex, end string) {
+	for !l.LookingAt(end) && !l.AtEnd() {
+		l.Next()
+	}
+	for i := 0; i < len(end) && !l.AtEnd(); i++ {
+		l.Next()
+	}
+	l.Ignore()
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFromDTDRoundTrip(t *testing.T) {
+	src := "doc id= kind=(a|b) version=#FIXED \"1\"\n" +
+		"  title lang=\"en\"\n" +
+		"  para => (PCDATA | bold | note...)*\n" +
+		"  hr #EMPTY\n" +
+		"  note ref=#IDREF #REQUIRED #ANY\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := WriteDTD(&want, root); err != nil {
+		t.Fatal(err)
+	}
+	back, err := FromDTD(strings.NewReader(want.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := WriteDTD(&got, back); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", want.String(), got.String())
+	}
+}
+
+func TestFromDTDNesting(t *testing.T) {
+	src := "<?xml version=\"1.0\"?>\n" +
+		"<!-- c refers back to b, and d is declared before its parent -->\n" +
+		"<!ELEMENT d (#PCDATA)>\n" +
+		"<!ELEMENT a (b, c)>\n" +
+		"<!ENTITY copy \"&#169;\">\n" +
+		"<!ELEMENT b (c?, d)>\n" +
+		"<!ELEMENT c (b*)>\n" +
+		"<!ELEMENT orphan (d)>\n"
+	root, err := FromDTD(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Name != "a" {
+		t.Fatalf("Expected root a, but found %s", root.Name)
+	}
+	var defs []string
+	for _, d := range root.defs {
+		defs = append(defs, d.Name)
+	}
+	if got := strings.Join(defs, " "); got != "a b c d orphan" {
+		t.Errorf("Expected definitions a b c d orphan, but found %s", got)
+	}
+	refs := func(e *Element) string {
+		var result []string
+		for _, c := range e.Content.children {
+			name := c.element.Name
+			if c.reference {
+				name += "..."
+			}
+			result = append(result, name)
+		}
+		return strings.Join(result, " ")
+	}
+	b := root.Content.children[0].element
+	expect := map[*Element]string{root: "b c...", b: "c d", b.Content.children[0].element: "b...", root.defs[4]: "d..."}
+	for e, want := range expect {
+		if got := refs(e); got != want {
+			t.Errorf("Expected %s to have %s, but found %s", e.Name, want, got)
+		}
+	}
+}
+
+func TestFromDTDErrors(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect string
+	}{
+		{"", "line 1, col 1: found end of input, expected element declaration"},
+		{"<!ELEMENT a EMPTY>\n<!ELEMENT a ANY>", "line 2, col 11: element a is defined more than once"},
+		{"<!ELEMENT a (b, c | d)>", `line 1, col 19: found "|" in a group separated by ","`},
+		{"<!ELEMENT a (%inline;)>", `line 1, col 14: found "%inline;", expected element name or group`},
+		{"<!ELEMENT a EMPTY", "line 1, col 18: found end of input, expected '>'"},
+		{"<!ATTLIST a x CDATA \"open>", "line 1, col 21: Unexpected end of input inside quoted value: \"open>"},
+		{"<!ATTLIST a x ID #IMPLIED y ID #IMPLIED>", "line 1, col 32: element a: attribute y: second ID attribute after x"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			_, err := FromDTD(strings.NewReader(tC.src))
+			if err == nil || err.Error() != tC.expect {
+				t.Errorf("Expected error %q, but found %v", tC.expect, err)
+			}
+		})
+	}
+}
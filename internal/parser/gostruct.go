@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// goAttrTypes maps DTD attribute types to Go field types.  Anything not
+// listed, including enumerations, is a string.
+var goAttrTypes = map[string]string{
+	"IDREFS":   "[]string",
+	"NMTOKENS": "[]string",
+	"ENTITIES": "[]string",
+}
+
+// GenerateGoStruct writes a Go struct for e with encoding/xml tags.  Each
+// attribute becomes an attr field and each child element a field whose type
+// follows its multiplicity: a slice when repeated, a pointer when optional.
+// Children that are plain text with no attributes are strings.
+func GenerateGoStruct(e *Element, w io.Writer) error {
+	var src bytes.Buffer
+	used := map[string]int{}
+	field := func(name, typ, tag string) {
+		name = goName(name)
+		if used[name]++; used[name] > 1 {
+			name += fmt.Sprint(used[name])
+		}
+		fmt.Fprintf(&src, "\t%s %s `xml:\"%s\"`\n", name, typ, tag)
+	}
+
+	fmt.Fprintf(&src, "type %s struct {\n", goName(e.Name))
+	field("XMLName", "xml.Name", e.Name)
+	for _, a := range e.Attrs {
+		typ, ok := goAttrTypes[strings.TrimPrefix(a.Type, "#")]
+		if !ok {
+			typ = "string"
+		}
+		tag := a.Name + ",attr"
+		if a.Occur != required {
+			tag += ",omitempty"
+		}
+		field(a.Name, typ, tag)
+	}
+	for _, c := range goChildren(&e.Content) {
+		typ := goName(c.element.Name)
+		if isTextOnly(c.element) {
+			typ = "string"
+		}
+		tag := c.element.Name
+		switch {
+		case c.repeated:
+			typ = "[]" + typ
+		case c.optional && typ == "string":
+			tag += ",omitempty"
+		case c.optional:
+			typ = "*" + typ
+		}
+		field(c.element.Name, typ, tag)
+	}
+	if e.Content.modelType == unknownModelType || e.Content.hasPCDATA() {
+		field("Text", "string", ",chardata")
+	}
+	src.WriteString("}\n")
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("element %s: %v", e.Name, err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// goChild is a child element particle with the multiplicity of its field.
+type goChild struct {
+	element  *Element
+	optional bool
+	repeated bool
+}
+
+// goChildren collects the distinct child elements of a content model.  An
+// element that appears more than once, or under * or +, is repeated; one
+// under ? or * or inside a choice is optional.
+func goChildren(c *ContentModel) []*goChild {
+	var result []*goChild
+	byName := map[string]*goChild{}
+	var walk func(c *ContentModel, optional, repeated bool)
+	walk = func(c *ContentModel, optional, repeated bool) {
+		switch c.multiplicity {
+		case optionalMultiplicity:
+			optional = true
+		case zeroOrMoreMultiplicity:
+			optional, repeated = true, true
+		case oneOrMoreMultiplicity:
+			repeated = true
+		}
+		if c.modelType == elementModelType {
+			if prev, ok := byName[c.element.Name]; ok {
+				prev.repeated = true
+				return
+			}
+			child := &goChild{c.element, optional, repeated}
+			byName[c.element.Name] = child
+			result = append(result, child)
+			return
+		}
+		for _, child := range c.children {
+			walk(child, optional || (c.modelType == choiceModelType && len(c.children) > 1), repeated)
+		}
+	}
+	walk(c, false, false)
+	return result
+}
+
+// isTextOnly reports whether e holds only character data and no attributes.
+func isTextOnly(e *Element) bool {
+	if len(e.Attrs) > 0 {
+		return false
+	}
+	switch e.Content.modelType {
+	case unknownModelType, pcdataModelType:
+		return true
+	}
+	return false
+}
+
+// goName converts an XML name like xml:lang or my-element to an exported Go
+// identifier like XmlLang or MyElement.
+func goName(name string) string {
+	var result strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if result.Len() == 0 && unicode.IsDigit(r) {
+			result.WriteRune('X')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		result.WriteRune(r)
+	}
+	return result.String()
+}
@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGoStruct(t *testing.T) {
+	paragraph := &Element{
+		Name: "paragraph",
+		Attrs: []Attribute{
+			{Name: "id", Type: "ID", Occur: implied},
+			{Name: "name", Type: "CDATA", Occur: required},
+			{Name: "justify", Type: "(left|right|center)", Occur: implied},
+		},
+	}
+	expect := "type Paragraph struct {\n" +
+		"\tXMLName xml.Name `xml:\"paragraph\"`\n" +
+		"\tId      string   `xml:\"id,attr,omitempty\"`\n" +
+		"\tName    string   `xml:\"name,attr\"`\n" +
+		"\tJustify string   `xml:\"justify,attr,omitempty\"`\n" +
+		"\tText    string   `xml:\",chardata\"`\n" +
+		"}\n"
+	var buf bytes.Buffer
+	if err := GenerateGoStruct(paragraph, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestGenerateGoStructChildren(t *testing.T) {
+	src := "doc xml:lang=#NMTOKENS kind=(report|memo) #REQUIRED\n" +
+		"  title?\n" +
+		"  (note | figure...)\n" +
+		"  item+\n" +
+		"  section* id=\n" +
+		"    heading\n" +
+		"    section...?\n" +
+		"  para => (PCDATA | bold)*\n" +
+		"figure src= #REQUIRED #EMPTY\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name, expect string
+	}{
+		{"doc", "type Doc struct {\n" +
+			"\tXMLName xml.Name  `xml:\"doc\"`\n" +
+			"\tXmlLang []string  `xml:\"xml:lang,attr,omitempty\"`\n" +
+			"\tKind    string    `xml:\"kind,attr\"`\n" +
+			"\tTitle   string    `xml:\"title,omitempty\"`\n" +
+			"\tNote    string    `xml:\"note,omitempty\"`\n" +
+			"\tFigure  *Figure   `xml:\"figure\"`\n" +
+			"\tItem    []string  `xml:\"item\"`\n" +
+			"\tSection []Section `xml:\"section\"`\n" +
+			"\tPara    Para      `xml:\"para\"`\n" +
+			"}\n"},
+		{"section", "type Section struct {\n" +
+			"\tXMLName xml.Name `xml:\"section\"`\n" +
+			"\tId      string   `xml:\"id,attr,omitempty\"`\n" +
+			"\tHeading string   `xml:\"heading\"`\n" +
+			"\tSection *Section `xml:\"section\"`\n" +
+			"}\n"},
+		{"para", "type Para struct {\n" +
+			"\tXMLName xml.Name `xml:\"para\"`\n" +
+			"\tBold    []string `xml:\"bold\"`\n" +
+			"\tText    string   `xml:\",chardata\"`\n" +
+			"}\n"},
+		{"figure", "type Figure struct {\n" +
+			"\tXMLName xml.Name `xml:\"figure\"`\n" +
+			"\tSrc     string   `xml:\"src,attr\"`\n" +
+			"}\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.name, func(t *testing.T) {
+			var e *Element
+			for _, r := range reachable(root) {
+				if r.Name == tC.name {
+					e = r
+				}
+			}
+			var buf bytes.Buffer
+			if err := GenerateGoStruct(e, &buf); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tC.expect {
+				t.Errorf("Expected:\n%s\nbut found:\n%s", tC.expect, got)
+			}
+		})
+	}
+}
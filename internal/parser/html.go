@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// GenerateHTMLDocs writes a self-contained HTML page documenting root and
+// every element it reaches.  Each element gets a section with the comments
+// on its definition, its content model, where child elements link to their
+// own sections, and a table of its attributes.
+func GenerateHTMLDocs(root *Element, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	title := html.EscapeString(root.Name)
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n", title)
+	fmt.Fprintf(bw, "<h1>%s</h1>\n", title)
+	for _, e := range reachable(root) {
+		name := html.EscapeString(e.Name)
+		fmt.Fprintf(bw, "<section id=\"%s\">\n<h2>%s</h2>\n", name, name)
+		if len(e.Doc) > 0 {
+			fmt.Fprintf(bw, "<p>%s</p>\n", html.EscapeString(strings.Join(e.Doc, "\n")))
+		}
+		content := e.Content.render(func(child *Element) string {
+			name := html.EscapeString(child.Name)
+			return "<a href=\"#" + name + "\">" + name + "</a>"
+		})
+		fmt.Fprintf(bw, "<p>Content: <code>%s</code></p>\n", content)
+		if len(e.Attrs) > 0 {
+			bw.WriteString("<table>\n<tr><th>Attribute</th><th>Type</th><th>Occurrence</th><th>Default</th></tr>\n")
+			for _, a := range e.Attrs {
+				occur := a.Occur
+				if occur == "" {
+					occur = implied
+				}
+				fmt.Fprintf(bw, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+					html.EscapeString(a.Name), html.EscapeString(a.Type), occur, html.EscapeString(a.Default))
+			}
+			bw.WriteString("</table>\n")
+		}
+		bw.WriteString("</section>\n")
+	}
+	bw.WriteString("</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// render formats the content model in DTD syntax, using name to format each
+// element particle.  An unset content model renders as the (#PCDATA) default.
+func (c *ContentModel) render(name func(*Element) string) string {
+	switch {
+	case c == nil:
+		return "EMPTY"
+	case c.modelType == unknownModelType, c.modelType == pcdataModelType:
+		return "(#PCDATA)" + string(c.multiplicity)
+	}
+	return c.particle(name)
+}
+
+// particle formats one fragment of a content model for render.
+func (c *ContentModel) particle(name func(*Element) string) string {
+	var body string
+	switch c.modelType {
+	case pcdataModelType:
+		body = "#PCDATA"
+	case elementModelType:
+		body = name(c.element)
+	case emptyModelType:
+		body = "EMPTY"
+	case anyModelType:
+		body = "ANY"
+	case entityModelType:
+		if len(c.children) == 0 {
+			body = "%" + c.entity.Name + ";"
+			break
+		}
+		body = c.children[0].particle(name)
+	default:
+		parts := make([]string, len(c.children))
+		for i, child := range c.children {
+			parts[i] = child.particle(name)
+		}
+		body = "(" + strings.Join(parts, getSep(c.modelType)) + ")"
+	}
+	return body + string(c.multiplicity)
+}
@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateHTMLDocs(t *testing.T) {
+	src := "# A document of sections.\n" +
+		"# Its title is <optional>.\n" +
+		"doc kind=(report|memo) #REQUIRED lang=\"en\"\n" +
+		"  title?\n" +
+		"  section+ id=\n" +
+		"    heading\n" +
+		"    section...*\n" +
+		"  para => (PCDATA | bold)*\n" +
+		"  hr #EMPTY\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := GenerateHTMLDocs(root, &buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, expect := range []string{
+		"<section id=\"doc\">\n<h2>doc</h2>\n<p>A document of sections.\nIts title is &lt;optional&gt;.</p>\n",
+		"<section id=\"title\">\n<h2>title</h2>\n<p>Content: <code>(#PCDATA)</code></p>\n</section>\n",
+		`<code>(<a href="#title">title</a>?, <a href="#section">section</a>+, <a href="#para">para</a>, <a href="#hr">hr</a>)</code>`,
+		`<code>(<a href="#heading">heading</a>, <a href="#section">section</a>*)</code>`,
+		`<code>(#PCDATA | <a href="#bold">bold</a>)*</code>`,
+		"<section id=\"hr\">\n<h2>hr</h2>\n<p>Content: <code>EMPTY</code></p>\n</section>\n",
+		`<tr><td>kind</td><td>(report|memo)</td><td>#REQUIRED</td><td></td></tr>`,
+		`<tr><td>lang</td><td>CDATA</td><td>#IMPLIED</td><td>en</td></tr>`,
+		`<tr><td>id</td><td>ID</td><td>#IMPLIED</td><td></td></tr>`,
+	} {
+		if !strings.Contains(got, expect) {
+			t.Errorf("Expected the page to contain %s, but found:\n%s", expect, got)
+		}
+	}
+	if n := strings.Count(got, `<section id="section">`); n != 1 {
+		t.Errorf("Expected one section for the recursive section, but found %d", n)
+	}
+}
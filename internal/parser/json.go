@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonModelTypes names the content model types in JSON.
+var jsonModelTypes = map[modelType]string{
+	unknownModelType:  "",
+	pcdataModelType:   "pcdata",
+	elementModelType:  "element",
+	groupModelType:    "group",
+	sequenceModelType: "sequence",
+	choiceModelType:   "choice",
+	allModelType:      "all",
+	emptyModelType:    "empty",
+	anyModelType:      "any",
+	entityModelType:   "entity",
+}
+
+// jsonDocument is the JSON form of a document: the name of its root, its
+// elements, and the parameter entities they use.
+type jsonDocument struct {
+	Root     string     `json:"root"`
+	Elements []*Element `json:"elements"`
+	Entities []*Entity  `json:"entities,omitempty"`
+}
+
+// jsonElement is the JSON form of an Element.
+type jsonElement struct {
+	Name      string            `json:"name"`
+	Attrs     []Attribute       `json:"attrs,omitempty"`
+	Content   ContentModel      `json:"content"`
+	Doc       []string          `json:"doc,omitempty"`
+	Docs      map[string]string `json:"docs,omitempty"`
+	Undefined bool              `json:"undefined,omitempty"`
+}
+
+// jsonContent is the JSON form of a ContentModel.  An element particle holds
+// the element name and an entity reference the entity name, so that shared
+// and recursive definitions are written once.
+type jsonContent struct {
+	Type         string          `json:"type,omitempty"`
+	Multiplicity string          `json:"multiplicity,omitempty"`
+	Element      string          `json:"element,omitempty"`
+	Reference    bool            `json:"reference,omitempty"`
+	Entity       string          `json:"entity,omitempty"`
+	Children     []*ContentModel `json:"children,omitempty"`
+}
+
+// MarshalJSON encodes e with its attributes and content model, in which
+// child elements appear by name.
+func (e Element) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonElement{e.Name, e.Attrs, e.Content, e.Doc, e.Docs, e.undefined})
+}
+
+// UnmarshalJSON decodes e.  The elements its content model names are
+// placeholders until FromJSON links them to their definitions.
+func (e *Element) UnmarshalJSON(data []byte) error {
+	var j jsonElement
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*e = Element{Name: j.Name, Attrs: j.Attrs, Content: j.Content, Doc: j.Doc, Docs: j.Docs, undefined: j.Undefined}
+	return nil
+}
+
+// MarshalJSON encodes the content model c, with its type and multiplicity as
+// strings like "sequence" and "?".
+func (c ContentModel) MarshalJSON() ([]byte, error) {
+	j := jsonContent{Type: jsonModelTypes[c.modelType], Multiplicity: string(c.multiplicity)}
+	switch c.modelType {
+	case elementModelType:
+		j.Element, j.Reference = c.element.Name, c.reference
+	case entityModelType:
+		j.Entity = c.entity.Name
+	default:
+		j.Children = c.children
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes the content model c.
+func (c *ContentModel) UnmarshalJSON(data []byte) error {
+	var j jsonContent
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*c = ContentModel{multiplicity: multiplicity(j.Multiplicity), reference: j.Reference}
+	found := false
+	for mt, name := range jsonModelTypes {
+		if name == j.Type {
+			c.modelType, found = mt, true
+		}
+	}
+	switch {
+	case !found:
+		return fmt.Errorf("unknown content model type %q", j.Type)
+	case c.modelType == elementModelType:
+		c.element = &Element{Name: j.Element}
+	case c.modelType == entityModelType:
+		c.entity = &Entity{Name: j.Entity}
+	default:
+		c.children = j.Children
+	}
+	return nil
+}
+
+// ToJSON writes the document rooted at e as indented JSON: the root name,
+// every element once, and the parameter entities they use.  When e is the
+// root returned by Parse, its unreachable definitions are written too.
+func (e *Element) ToJSON(w io.Writer) error {
+	elements := append([]*Element{}, e.defs...)
+	seen := map[*Element]bool{}
+	for _, d := range elements {
+		seen[d] = true
+	}
+	for _, r := range reachable(e) {
+		if !seen[r] {
+			elements = append(elements, r)
+		}
+	}
+	entities, _ := usedEntities(elements)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonDocument{e.Name, elements, entities})
+}
+
+// FromJSON reads a document written by ToJSON and returns its root, with the
+// element and entity names in content models linked to their definitions.
+// A name with no definition is an undefined element of (#PCDATA) content.
+func FromJSON(r io.Reader) (*Element, error) {
+	var doc jsonDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	elements := elementMap{}
+	for _, e := range doc.Elements {
+		elements[e.Name] = e
+	}
+	entities := map[string]*Entity{}
+	for _, e := range doc.Entities {
+		entities[e.Name] = e
+	}
+	var link func(c *ContentModel) error
+	link = func(c *ContentModel) error {
+		switch c.modelType {
+		case elementModelType:
+			e, ok := elements[c.element.Name]
+			if !ok {
+				e = &Element{Name: c.element.Name, Content: ContentModel{modelType: pcdataModelType}, undefined: true}
+				elements[e.Name] = e
+			}
+			c.element = e
+		case entityModelType:
+			e, ok := entities[c.entity.Name]
+			if !ok {
+				return fmt.Errorf("parameter entity %%%s is referenced but never defined", c.entity.Name)
+			}
+			c.entity, c.children = e, []*ContentModel{&e.Content}
+			return nil // the entity content is linked on its own
+		}
+		for _, child := range c.children {
+			if err := link(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, e := range doc.Entities {
+		if err := link(&e.Content); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range doc.Entities {
+		if refersTo(&e.Content, e, map[*Entity]bool{}) {
+			return nil, fmt.Errorf("parameter entity %%%s refers to itself", e.Name)
+		}
+	}
+	root, ok := elements[doc.Root]
+	if !ok {
+		return nil, fmt.Errorf("root element %s is not among the elements", doc.Root)
+	}
+	for _, e := range doc.Elements {
+		if err := link(&e.Content); err != nil {
+			return nil, err
+		}
+		if !e.undefined {
+			root.defs = append(root.defs, e)
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	src := "doc id= kind=(a|b) #REQUIRED\n" +
+		"  title? lang=\"en\"\n" +
+		"  (para | list...)+\n" +
+		"list\n" +
+		"  item => (PCDATA | %inline)*\n" +
+		"  list...?\n" +
+		"%inline = (b | i)\n" +
+		"orphan #EMPTY\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var js bytes.Buffer
+	if err := root.ToJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"type": "sequence"`, `"multiplicity": "?"`, `"element": "list"`, `"reference": true`, `"entity": "inline"`} {
+		if !strings.Contains(js.String(), want) {
+			t.Errorf("Expected the JSON to contain %s, but found:\n%s", want, js.String())
+		}
+	}
+	back, err := FromJSON(strings.NewReader(js.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := back.ToJSON(&again); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != js.String() {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", js.String(), again.String())
+	}
+	var want, got bytes.Buffer
+	if err := WriteDTD(&want, root); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteDTD(&got, back); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", want.String(), got.String())
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect string
+	}{
+		{`{"root": "a", "elements": [{"name": "a", "content": {"type": "list"}}]}`, `unknown content model type "list"`},
+		{`{"root": "b", "elements": [{"name": "a", "content": {}}]}`, "root element b is not among the elements"},
+		{`{"root": "a", "elements": [{"name": "a", "content": {"type": "entity", "entity": "x"}}]}`, "parameter entity %x is referenced but never defined"},
+		{`{"root": "a", "elements": [], "entities": [{"name": "x", "content": {"type": "entity", "entity": "x"}}]}`, "parameter entity %x refers to itself"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.expect, func(t *testing.T) {
+			_, err := FromJSON(strings.NewReader(tC.src))
+			if err == nil || err.Error() != tC.expect {
+				t.Errorf("Expected error %q, but found %v", tC.expect, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/adobrowolski/dtdx/internal/lexer"
+)
+
+// ErrorKind identifies a class of error whose message can be customized.
+// Each kind documents the arguments its format string receives, in order.
+type ErrorKind int
+
+const (
+	// RunawayQuote is a quote with no closing quote: the text after the quote.
+	RunawayQuote ErrorKind = iota
+	// InconsistentDedent is a dedent to no open level: expected and found width.
+	InconsistentDedent
+	// UnexpectedChar is a rune that starts no token: the rune (use %#U).
+	UnexpectedChar
+	// MalformedEllipsis is a run of dots that is not a reference: the dots.
+	MalformedEllipsis
+	// DisallowedIndent breaks the IndentPolicy: the found and allowed whitespace.
+	DisallowedIndent
+	// UnexpectedToken is a token the grammar does not allow: its literal.
+	UnexpectedToken
+	// QuoteEOF is the end of input inside a quoted value: the text so far.
+	QuoteEOF
+	// ReferenceEOF is the end of input inside a reference ellipsis: the dots.
+	ReferenceEOF
+	// ExpectedToken is a token out of place in content: what was found and
+	// what was expected.
+	ExpectedToken
+	// DuplicateElement is a second definition of an element: its name.
+	DuplicateElement
+	// MixedSeparators is a separator unlike the others in its group: the
+	// separator found and the one used before it.
+	MixedSeparators
+	// ContentConflict is an element with indented children as well as other
+	// content: the element name and the other content.
+	ContentConflict
+	// DuplicateEntity is a second definition of a parameter entity: its name.
+	DuplicateEntity
+	// UndefinedEntity is a parameter entity that is referenced but never
+	// defined: its name.
+	UndefinedEntity
+	// CyclicEntity is a parameter entity whose content refers back to it: its
+	// name.
+	CyclicEntity
+	// MalformedName is an element or attribute name with more than one
+	// colon: the name.
+	MalformedName
+	// CircularInclude is an #INCLUDE of a file that is already being read:
+	// its path.
+	CircularInclude
+	// NoResolver is an #INCLUDE in a parser without a Resolve function: the
+	// path.
+	NoResolver
+	// DoubleModifier is a child definition with a modifier after its name
+	// and another after its attributes: the element name.
+	DoubleModifier
+	// EmptyDocument is a document with no element definition, only blank
+	// lines, comments or entities.  It has no arguments.
+	EmptyDocument
+	// LeadingSeparator is a separator before the first particle of a group:
+	// the separator.
+	LeadingSeparator
+	// DoubleSeparator is a separator right after another: the second one.
+	DoubleSeparator
+	// TrailingSeparator is a separator after the last particle of a group:
+	// the separator.
+	TrailingSeparator
+	// TopLevelModifier is a modifier on a top level definition, which is
+	// no particle: the element name and the modifier.
+	TopLevelModifier
+	// AttributeAfterContent is an attribute written among the content of an
+	// element rather than on its definition line: the attribute name and
+	// the element name.
+	AttributeAfterContent
+	// UnsupportedFeature is syntax that the #dtdx version of the file does
+	// not have: what it is and the first version that has it.
+	UnsupportedFeature
+	// TrailingContent is a token at the top level after a definition that
+	// starts no other definition: the token.
+	TrailingContent
+)
+
+// Messages maps error kinds to fmt format strings.  A Messages value given to
+// the scanner or parser overrides the defaults for the kinds it contains.
+type Messages map[ErrorKind]string
+
+var defaultMessages = Messages{
+	RunawayQuote:       "Runaway quote: %s",
+	InconsistentDedent: "Inconsistent dedent. Expecting %d but found %d.",
+	UnexpectedChar:     "Unexpected unicode character (%#U) in outer context.",
+	MalformedEllipsis:  "Malformed reference ellipsis: %s",
+	DisallowedIndent:   "Indentation uses %s but only %s are allowed.",
+	UnexpectedToken:    "found %q, expected element identifier",
+	QuoteEOF:           "Unexpected end of input inside quoted value: %s",
+	ReferenceEOF:       "Unexpected end of input inside reference ellipsis: %s",
+	ExpectedToken:      "found %s, expected %s",
+	DuplicateElement:   "element %s is defined more than once",
+	MixedSeparators:    "found %q in a group separated by %q",
+	ContentConflict:    "element %s has both %s and indented children",
+	DuplicateEntity:    "parameter entity %%%s is defined more than once",
+	UndefinedEntity:    "parameter entity %%%s is referenced but never defined",
+	CyclicEntity:       "parameter entity %%%s refers to itself",
+	MalformedName:      "name %s has more than one colon",
+	CircularInclude:    "circular #INCLUDE of %s",
+	NoResolver:         "cannot #INCLUDE %s without a resolver",
+	DoubleModifier:     "element %s has a modifier after its name and another after its attributes",
+	EmptyDocument:      "document has no element definition",
+	LeadingSeparator:   "found %q before the first particle of a group",
+	DoubleSeparator:    "found %q right after another separator",
+	TrailingSeparator:  "found %q after the last particle of a group",
+	TopLevelModifier:   "element %s is defined at the top level and cannot have the modifier %s",
+
+	AttributeAfterContent: "attribute %s of %s follows its content; attributes go on the definition line",
+	UnsupportedFeature:    "%s needs #dtdx %s or later",
+	TrailingContent:       "unexpected trailing content %q",
+}
+
+// format renders the message of the given kind, preferring an override in m.
+func (m Messages) format(kind ErrorKind, args ...interface{}) string {
+	msg, ok := m[kind]
+	if !ok {
+		msg = defaultMessages[kind]
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// scanErrorf emits the scanner error of the given kind and ends the scan, or,
+// when the scanner recovers from errors, drops the rest of the line and goes
+// on at the next.
+func scanErrorf(l *lexer.Lex, kind ErrorKind, args ...interface{}) lexer.StateFunc {
+	st := getState(l)
+	l.Errorf("%s", st.messages.format(kind, args...))
+	if !st.recover {
+		return nil
+	}
+	return skipLine
+}
+
+// skipLine ignores the input up to the end of the line.
+func skipLine(l *lexer.Lex) lexer.StateFunc {
+	l.AcceptTo("")
+	l.Ignore()
+	return OuterState
+}
@@ -9,6 +9,12 @@
 // name followed by a "..." suffix.  The definition does not need to come before
 // the reference.
 //
+// A name without the "..." suffix is always a definition, even when it stands
+// alone on its line with no attributes or children; its content model then
+// defaults to (#PCDATA). Only name... is a reference. A bare name nested under
+// a parent is therefore a new child definition, never a reference to an element
+// defined elsewhere, and defining it twice is an error.
+//
 // Here is an example dtdx document that defines paragraph structures.
 //
 // 		# The first top level definition.
@@ -22,21 +28,31 @@
 //			(PCDATA, bold)*
 //
 // The first element to be defined, paragraph, is the root of the DTD. The content
-// models of title and bold default to (#PCDATA).
+// models of title and bold default to (#PCDATA).  A comment documents the
+// definition on the line right after it, or the one it follows on its line.
+// One in the form "# @desc: text" goes into the Docs of the element under its
+// key, desc, rather than into its Doc.
 //
 // This example document is equivalent to the DTD:
 //
-// 		<!ELEMENT paragraph 	(title?, line+)>
-// 		<!ELEMENT title 		(#PCDATA)>
-// 		<!ELEMENT line 			(#PCDATA,bold)* >
-// 		<!ELEMENT bold 			(#PCDATA)>
+//		<!-- The first top level definition. -->
+//		<!ELEMENT paragraph (title?, line+)>
+//		<!-- A definition with two references nested inside paragraph. -->
+//		<!ELEMENT title     (#PCDATA)>
+//		<!-- A second top level definition. -->
+//		<!ELEMENT line      (#PCDATA, bold)*>
+//		<!ELEMENT bold      (#PCDATA)>
 //
 // Attributes are defined after the element name as a list of name value pairs.
 // The attribute name must be followed by '=' with no intervening space, followed
 // by an optional type. If left off the type is derived from the name. This usually
 // defaults to CDATA. If the name is id, idref or idrefs then the type is the upper
-// case value of the name. The type can also be a list of NMTOKEN values separated
-// by the vertical bar character '|' to create an enumerated attribute type.
+// case value of the name, and if it is number the type is NMTOKEN. The type can also be a list of NMTOKEN values separated
+// by the vertical bar character '|' to create an enumerated attribute type,
+// and NOTATION before the list, as in format=NOTATION(gif|jpeg), makes it a
+// list of notation names.  An IDREF or IDREFS type may name the element its
+// values refer to, as in ref=#IDREF->widget, which a DTD can only record in a
+// comment.
 //
 // Here is an example of an element definition with three attributes.
 //
@@ -45,90 +61,1319 @@
 //
 // This example document is equivalent to the DTD:
 //
-// 		<!ELEMENT paragraph 	(#PCDATA)>
+//		<!ELEMENT paragraph (#PCDATA)>
 //		<!ATTLIST paragraph
-//				id 		ID 					#IMPLIED
-//				name 	CDATA 				#IMPLIED
-// 				justify (left|right|center) #IMPLIED
-//				>
+//		    id      ID                  #IMPLIED
+//		    name    CDATA               #IMPLIED
+//		    justify (left|right|center) #IMPLIED
+//		    >
+//
+// A parameter entity names a content model fragment that several elements
+// share.  It is defined at the top level by '%', its name, '=' and inline
+// content, and referenced by %name within content.
+//
+//		%inline = (bold | italic)
+//		para => (PCDATA | %inline)*
+//
+// This example document is equivalent to the DTD:
+//
+//		<!ENTITY % inline "bold | italic">
+//		<!ELEMENT para   (#PCDATA | %inline;)*>
+//		<!ELEMENT bold   (#PCDATA)>
+//		<!ELEMENT italic (#PCDATA)>
+//
+// A document can be split across files.  A top level #INCLUDE names another
+// DTDX file, relative to the directory of the including file, whose
+// definitions join the document.
+//
+//		#INCLUDE "common.dtdx"
+//
+// The first line of a file may declare the version of DTDX it is written in,
+// as in #dtdx 1.0.  Version 1.0 has no IDREF targets; 1.1, the latest, has
+// them, and so does a file without the line.  An unknown version is a
+// warning, and the file is read as the latest.
 package parser
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/adobrowolski/dtdx/internal/lexer"
 )
 
 /* --------------------------------------------------------------
 
-dtdx            := (comment | elementDef)*
+dtdx            := (comment | elementDef | entityDef | include)*
+include         := '#INCLUDE' Value
+entityDef       := entityRef '=' contentBody
+entityRef       := '%' identifier ';'?
 comment         := '#' text '\n'
 element         := elementDef | elementRef
-elementDef      := name attrs content
+elementDef      := name attrs ( content | keyword )
+childDef        := name modifier? attrs modifier? ( content | keyword )
+keyword         := '#EMPTY' | '#ANY'
 elementRef      := name Ellipsis
 name            := identifier
-attrs           := name '=' type?
-type            := directive | enumeration
+attrs           := name '=' type? default?
+type            := directive target? | enumeration | 'NOTATION' enumeration
+target          := '->' name
+default         := Value | '#REQUIRED' | '#IMPLIED' | '#FIXED' Value
 directive       := '#' identifier
 enumeration     := '(' values ')'
-values          := Value ( '|' values )
+values          := Value ( '|' values )?
 content         := contentStart contentBody
 contentBody     := ( parenContent | nakedContent )
 parenContent    := '(' contentBody ')'
 nakedContent    := elementList
 elementList     := elementChild (elementSep elementList)?
-elementChild    := comment | element modifier?
+elementChild    := comment | childDef | ( elementRef | entityRef ) modifier?
 modifier        := '*' | '+' | '?'
-contentStart    := greaterIndent | '=>'
+contentStart    := greaterIndent | '=>' greaterIndent?
 elementSep      := sameIndent | ','
 greaterIndent   := '\n' indentTok             [len(tok.value)>parent.indent]
 sameIndent      := '\n' indentTok             [len(tok.value)==parent.indent]
 
------------------------------------------------------------------- */
+The modifier of a child definition follows its attributes, as in
+"title id= ?", or comes right after its name, as in "title? id=", but not
+both.  An '=>' at the end of a definition line introduces the indented
+children on the lines after it, just as the indent alone does.  PCDATA and #PCDATA both stand for character
+data within content.  Inside parentheses the separators must all be the same;
+on indented lines they may be left out, which makes a sequence.  A top
+level declaration ends its line, and so does an indented particle that no
+separator follows.  The attributes of a definition are on its line; one
+written among its content instead is an error, reported at its name.
 
-// elementMap maps element names to their definitions.
-//
-// While a new element is being defined the value is the placeholder.
-type elementMap map[string]Element
+------------------------------------------------------------------ */
 
-var elements = elementMap{}
+// elementMap maps element names to their elements.
+type elementMap map[string]*Element
 
 // Parser represents a parser.
+//
+// Warn receives the warnings found while parsing. It may be set after
+// NewParser and before Parse; a nil Warn discards all warnings.  Messages
+// overrides the wording of errors by kind.  Resolve opens the file that an
+// #INCLUDE names, after a relative path has been joined to the directory of
+// the including file; without it #INCLUDE is an error.  OnReference, if set,
+// is called for each element that a content model names, whether it is
+// defined there or referred to, with the element whose content it is, the
+// name and its modifier: "", "?", "*" or "+".  In the content of a parameter
+// entity there is no such element, and from is nil.
+//
+// The scanner options apply to the document and every file it includes.
+// LenientEllipsis accepts a run of two or more dots as a reference, with a
+// warning.  RefSuffix, if set, marks a reference in place of "...".
+// IndentPolicy restricts the whitespace that lines may be indented with.
+// CheckIndentUnit warns about an indent step that differs in width from the
+// first one in its file.  TabWidth is the distance between tab stops in
+// indentation, or lexer.DefaultTabWidth when it is 0.
+//
+// Lenient makes an unknown directive a warning rather than an error.  An
+// attribute type that a DTD does not have, such as #URI, is read as CDATA,
+// and an unknown directive after the attributes of a definition is skipped.
+//
+// The lints are off by default and find what is legal but likely a mistake,
+// reporting each with a warning.  CheckReserved warns about an enumeration
+// value, or a value of an NMTOKEN or NMTOKENS default, that begins with xml
+// in any case, which XML reserves.  CheckMultiplicity warns when the content
+// of an element names another element more than once with different
+// modifiers, as in (line+, line?), which may be meant as one multiplicity.
+// CheckRedundant warns about the content (#PCDATA) written for an element
+// that was referenced before, which gave it that content already.
 type Parser struct {
+	Warn     func(Diagnostic)
+	Messages Messages
+	Resolve  func(path string) (io.Reader, error)
+	Lenient  bool
+
+	CheckReserved     bool
+	CheckMultiplicity bool
+	CheckRedundant    bool
+
+	OnReference func(from *Element, ref string, m string)
+
+	LenientEllipsis bool
+	RefSuffix       string
+	IndentPolicy    IndentPolicy
+	CheckIndentUnit bool
+	TabWidth        int
+
+	elements elementMap // definitions of this document only
+	refs     elementMap // referenced elements with no definition yet
+	order    []string   // element names in definition order
+
+	attrsOnly  map[*Element]bool // defined with attributes but no content yet
+	completing *Element          // the one of them being given its content
+	from       *Element          // the element whose content is being read
+
+	named   map[*Element]map[string]multiplicity // of each content, the modifiers it names elements with
+	handler Handler                              // of ParseStream, or nil
+
+	entities   map[string]*Entity // parameter entities defined so far
+	entityRefs map[string]*Entity // referenced entities with no definition yet
+	entityList []*Entity          // all entities in order of first mention
+
+	doc       []string // comment lines not yet attached to a definition
+	docLine   int      // line of the last of them
+	trail     string   // a comment after tokens on a line with no definition yet
+	trailLine int      // line of trail
+	lineDef   *Element // first element defined on the line last defined on
+
+	lastLine int         // line of the last token read, comments included
+	blanks   map[int]int // number of blank lines before a line, if any
+	version  string      // of the #dtdx line of the file, or "" for the latest
+
+	path      string   // file being read, or "" for a reader
+	including []string // paths of the files being read, outermost first
+
+	recovering bool    // collect errors and go on, as ParseAll does
+	errs       []error // errors collected while recovering
+
 	s   *lexer.Lex
 	buf struct {
-		tok lexer.Token // last read token
-		lit string      // last read literal
-		n   int         // buffer size (max=1)
+		tok  [3]lexer.Token // last read tokens, most recent first
+		last [3]lexer.Token // of each, the last token up to it that is not layout
+		n    int            // number of tokens pushed back (max=2)
 	}
 }
 
 // NewParser returns a new instance of Parser.
 func NewParser(r io.Reader) *Parser {
+	p := &Parser{}
+	p.Reset(r)
+	return p
+}
+
+// NewFileParser returns a Parser that reads the DTDX file at path and
+// resolves its #INCLUDE directives against the file system.
+func NewFileParser(path string) (*Parser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p := NewParser(f)
+	p.path = path
+	p.Resolve = func(path string) (io.Reader, error) { return os.Open(path) }
+	return p, nil
+}
+
+// Reset discards the definitions and lookahead of the previous document and
+// makes the parser read the next document from r.  Options such as Warn are
+// kept, so one Parser can parse many documents in sequence.
+func (p *Parser) Reset(r io.Reader) {
+	p.reset(r, NewlineState)
+}
+
+// reset is Reset for input whose scan starts in the given state.
+func (p *Parser) reset(r io.Reader, start lexer.StateFunc) {
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(r)
 	input := buf.String()
-	return &Parser{s: lexer.New(input, nil)}
+	p.elements = elementMap{}
+	p.refs = elementMap{}
+	p.order = nil
+	p.attrsOnly, p.completing, p.from = map[*Element]bool{}, nil, nil
+	p.named = map[*Element]map[string]multiplicity{}
+	p.entities = map[string]*Entity{}
+	p.entityRefs = map[string]*Entity{}
+	p.entityList = nil
+	p.doc, p.docLine, p.lineDef = nil, 0, nil
+	p.trail, p.trailLine = "", 0
+	p.lastLine, p.blanks, p.version = 0, map[int]int{}, ""
+	p.path, p.including = "", nil
+	p.recovering, p.errs = false, nil
+	p.s = lexer.New(input, start)
+	p.buf.n = 0
 }
 
-// Parse parses a DTDX document
+// Parse parses a DTDX document and returns its root, the first top level
+// definition.  An element that is referenced but never defined, or defined with
+// no children, has the content model (#PCDATA).  One defined with attributes
+// but no content may be defined once more with its content, and then has the
+// attributes of both definitions.  A parameter entity that is referenced but
+// never defined, or whose content refers back to it, is an error.  So is a
+// token at the top level that starts no definition, which after the first
+// one is reported as unexpected trailing content at its position.
+//
+// A top level #INCLUDE "path" reads the definitions of another DTDX file into
+// the document, as if they were written in its place, except that they never
+// become the root.  A file that includes itself, directly or not, is an error.
+//
+// Parse stops at the first error, such as a runaway quote, and returns it
+// with the root of the definitions read before it, so an editor can still
+// show their structure.  The root is nil when the error comes before the
+// first definition.
 func (p *Parser) Parse() (*Element, error) {
-	elem := Element{}
+	root, errs := p.parse(false)
+	if len(errs) > 0 {
+		return root, errs[0]
+	}
+	return root, nil
+}
+
+// ParseAll parses a DTDX document as Parse does, but goes on after an error
+// and returns every error it finds, in input order, with the best-effort
+// root.  After a scanner error, such as a runaway quote, scanning resumes at
+// the next line.  After any error the parser skips to the next top level
+// definition, the first token at the start of a later line that is not
+// indented.  Definitions read before an error stay in the document, so the
+// root is nil only when no element is defined.
+func (p *Parser) ParseAll() (*Element, []error) {
+	return p.parse(true)
+}
 
-	// First token should be a "SELECT" keyword.
-	if tok, lit := p.scan(); tok != identifierTok {
-		return nil, fmt.Errorf("found %q, expected element identifier", lit)
+// ElementNames returns the names of the elements that the last document
+// parsed defines, in the order of their definitions.  Elements that are only
+// referenced are not among them.
+func (p *Parser) ElementNames() []string {
+	return append([]string(nil), p.order...)
+}
+
+// IsDefined reports whether the last document parsed defines the element
+// name.
+func (p *Parser) IsDefined(name string) bool {
+	_, ok := p.elements[name]
+	return ok
+}
+
+// EntityUse tells whether the content of the document uses a parameter
+// entity that it declares.
+type EntityUse struct {
+	Name string // name of the entity, without the %
+	Used bool   // referenced by the content of an element, or of a used entity
+}
+
+// Manifest lists the parameter entities that the last document parsed
+// declares, in the order they were first mentioned, and whether each is
+// used, so that those merely declared can be removed.
+func (p *Parser) Manifest() []EntityUse {
+	var elements []*Element
+	for _, name := range p.order {
+		elements = append(elements, p.elements[name])
+	}
+	used, _ := usedEntities(elements)
+	isUsed := map[*Entity]bool{}
+	for _, e := range used {
+		isUsed[e] = true
+	}
+	var result []EntityUse
+	for _, e := range p.entityList {
+		if _, declared := p.entities[e.Name]; declared {
+			result = append(result, EntityUse{Name: e.Name, Used: isUsed[e]})
+		}
+	}
+	return result
+}
+
+// Rename renames the element old of the last document parsed to new, which
+// every reference to it follows, and so does each IDREF attribute whose
+// target it is.  It fails if the document neither defines nor references
+// old, if new is not a legal element name, or if an element new exists.
+func (p *Parser) Rename(old, new string) error {
+	elements := p.elements
+	e, ok := elements[old]
+	if !ok {
+		if e, ok = p.refs[old]; !ok {
+			return fmt.Errorf("rename %s: no such element", old)
+		}
+		elements = p.refs
+	}
+	if !isName(new) || strings.Count(new, ":") > 1 {
+		return fmt.Errorf("rename %s: %q is not a legal element name", old, new)
+	}
+	if _, ok := p.elements[new]; ok || p.refs[new] != nil {
+		return fmt.Errorf("rename %s: element %s already exists", old, new)
+	}
+	delete(elements, old)
+	elements[new] = e
+	e.Name = new
+	for i, name := range p.order {
+		if name == old {
+			p.order[i] = new
+		}
 	}
+	for _, d := range p.elements {
+		for i := range d.Attrs {
+			if d.Attrs[i].Target == old {
+				d.Attrs[i].Target = new
+			}
+		}
+	}
+	return nil
+}
+
+// parse parses a DTDX document, stopping at the first error unless it
+// recovers.
+func (p *Parser) parse(recovering bool) (*Element, []error) {
+	p.recovering, p.errs = recovering, nil
+	p.s.State = p.scanState()
+	p.s.TabWidth = p.TabWidth
+	p.including = []string{p.path}
 
-	return &elem, nil
+	root, err := p.declarations()
+	if err != nil {
+		p.errs = append(p.errs, err)
+	}
+	if root == nil {
+		if len(p.errs) == 0 {
+			p.errs = append(p.errs, errors.New(p.Messages.format(EmptyDocument)))
+		}
+		return nil, p.errs
+	}
+	if err == nil {
+		if err := p.checkEntities(); err != nil {
+			p.errs = append(p.errs, err)
+		}
+	}
+	for _, e := range p.refs {
+		e.Content = ContentModel{modelType: pcdataModelType}
+		e.undefined = true
+	}
+	for _, name := range p.order {
+		p.elements[name].splitDocs()
+		root.defs = append(root.defs, p.elements[name])
+	}
+	root.source = p.path
+	return root, p.errs
+}
+
+// scanState returns the state that scans a file with the options of p.
+func (p *Parser) scanState() *scanState {
+	return &scanState{
+		lenientEllipsis: p.LenientEllipsis,
+		refSuffix:       p.RefSuffix,
+		indentPolicy:    p.IndentPolicy,
+		checkIndentUnit: p.CheckIndentUnit,
+		messages:        p.Messages,
+		recover:         p.recovering,
+	}
+}
+
+// declarations parses the top level definitions of the file being read and
+// returns the first element it defines, if any, even with an error.  While
+// recovering, an error is collected and the rest of its definition skipped.
+func (p *Parser) declarations() (*Element, error) {
+	var first *Element
+	for {
+		var err error
+		tok, lit := p.scan()
+		switch {
+		case tok == identifierTok:
+			if err = p.checkName(lit); err != nil {
+				break
+			}
+			var e *Element
+			line, col := p.pos()
+			if e, err = p.define(lit, line, col, true); err == nil && first == nil {
+				first = e
+			}
+			if err == nil {
+				err = p.topLevelModifier(lit)
+			}
+		case tok == entityTok:
+			err = p.entity(lit)
+		case tok == directiveTok && lit == "#INCLUDE":
+			err = p.include()
+		case tok == eofTok:
+			return first, nil
+		case tok == lexer.ErrorTok:
+			err = p.positioned(lit)
+		case first != nil:
+			err = p.errorf(TrailingContent, lit)
+		default:
+			err = p.errorf(UnexpectedToken, lit)
+		}
+		if err == nil {
+			err = p.endOfLine()
+		}
+		if err != nil {
+			if !p.recovering {
+				return first, err
+			}
+			p.errs = append(p.errs, err)
+			p.resync()
+		}
+	}
+}
+
+// topLevelModifier returns an error if a modifier follows the top level
+// definition of name on its line, after the name or after its attributes.  The element is not a particle of any content, so it has no
+// multiplicity, and the first definition is the document element.
+func (p *Parser) topLevelModifier(name string) error {
+	if tok, lit := p.scan(); tok == multiplicityTok && p.onSameLine() {
+		return p.errorf(TopLevelModifier, name, lit)
+	}
+	p.unscan()
+	return nil
+}
+
+// resync skips the tokens after an error up to the next top level
+// definition: the first token after the line of the error that starts a line
+// with no indent.  That token is left to be read again.
+func (p *Parser) resync() {
+	line, _ := p.pos()
+	for {
+		tok, _ := p.scan()
+		if tok == eofTok {
+			p.unscan()
+			return
+		}
+		if l, c := p.pos(); l > line && c == 1 && tok != indentTok && tok != dedentTok {
+			p.unscan()
+			return
+		}
+	}
+}
+
+// endOfLine returns an error unless the top level declaration just read
+// ends its line, so that each declaration is on lines of its own.
+func (p *Parser) endOfLine() error {
+	if tok, lit := p.scan(); p.onSameLine() {
+		return p.unexpected(tok, lit, "end of line")
+	}
+	p.unscan()
+	return nil
+}
+
+// include reads the file that an #INCLUDE names into the document.  Errors
+// in that file are prefixed with its path.
+func (p *Parser) include() error {
+	tok, name := p.scan()
+	if tok != quoteTok {
+		return p.unexpected(tok, name, "quoted path after #INCLUDE")
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(p.path), path)
+	}
+	for _, open := range p.including {
+		if open == path {
+			return p.errorf(CircularInclude, path)
+		}
+	}
+	if p.Resolve == nil {
+		return p.errorf(NoResolver, path)
+	}
+	r, err := p.Resolve(path)
+	if err != nil {
+		return p.positioned(err.Error())
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(r)
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+
+	saved := *p
+	p.s = lexer.New(buf.String(), NewlineState)
+	p.s.State = p.scanState()
+	p.s.TabWidth = p.TabWidth
+	p.buf.n = 0
+	p.doc, p.trailLine, p.lineDef = nil, 0, nil
+	p.lastLine, p.blanks, p.version = 0, map[int]int{}, ""
+	p.path, p.including = path, append(p.including, path)
+	n := len(p.errs)
+	_, err = p.declarations()
+	for i := n; i < len(p.errs); i++ {
+		p.errs[i] = fmt.Errorf("%s: %v", path, p.errs[i])
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	p.s, p.buf, p.path, p.including = saved.s, saved.buf, saved.path, saved.including
+	p.doc, p.docLine, p.trail, p.trailLine, p.lineDef = saved.doc, saved.docLine, saved.trail, saved.trailLine, saved.lineDef
+	p.lastLine, p.blanks, p.version = saved.lastLine, saved.blanks, saved.version
+	return nil
+}
+
+// define parses the definition of the element name, whose identifier has been
+// read at line and col.  Only an indented definition may have its children on
+// the lines that follow; one inside parentheses ends after its attributes.
+func (p *Parser) define(name string, line, col int, indented bool) (*Element, error) {
+	_, referenced := p.refs[name]
+	e, err := p.declare(name, line, col)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.content(e, indented); err != nil {
+		return nil, err
+	}
+	p.defined(e, line, col, referenced)
+	return e, nil
+}
+
+// defined completes the definition of e, whose name was read at line and
+// col, once its content has been read.  Referenced tells whether e was
+// referenced before, for CheckRedundant.
+func (p *Parser) defined(e *Element, line, col int, referenced bool) {
+	e.DefPos = p.span(line, col)
+	if p.handler != nil {
+		p.handler.EndElement(e.Name)
+	}
+	c := &e.Content
+	if p.CheckRedundant && referenced && c.modelType == groupModelType && len(c.children) == 1 &&
+		c.children[0].modelType == pcdataModelType && c.multiplicity == singleMultiplicity &&
+		c.children[0].multiplicity == singleMultiplicity {
+		p.warnf("line %d, col %d: element %s is defined as (#PCDATA), which its references already make it", line, col, e.Name)
+	}
+}
+
+// declare parses the head of the definition of the element name, whose
+// identifier has been read at line and col: its attributes, and the comments
+// before it or on its line.
+func (p *Parser) declare(name string, line, col int) (*Element, error) {
+	e, ok := p.elements[name]
+	switch {
+	case ok && p.attrsOnly[e]: // the definition with its content
+		delete(p.attrsOnly, e)
+		p.completing = e
+	case ok:
+		return nil, p.errorf(DuplicateElement, name)
+	default:
+		if e, ok = p.refs[name]; ok { // fill in the element that references point to
+			delete(p.refs, name)
+		} else {
+			e = &Element{Name: name}
+		}
+		e.line, e.col = line, col
+		p.elements[name] = e
+		p.order = append(p.order, name)
+		e.blanks = p.blanks[line]
+	}
+	if len(p.doc) > 0 && p.docLine == line-1 {
+		if p.completing != e {
+			e.blanks = p.blanks[p.docLine-len(p.doc)+1]
+		}
+		e.Doc, p.doc = append(e.Doc, p.doc...), nil
+	}
+	if p.trailLine == line { // read ahead of the definition
+		e.Doc = append(e.Doc, p.trail)
+		p.trailLine = 0
+	}
+	if p.lineDef == nil || p.lineDef.line != e.line {
+		p.lineDef = e
+	}
+
+	if p.handler != nil {
+		p.handler.StartElement(name)
+	}
+	if err := p.attributes(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// content parses the content of the element e after its head: a keyword,
+// inline content after '=>', or its children on the indented lines that
+// follow, which an '=>' at the end of the line may introduce.
+func (p *Parser) content(e *Element, indented bool) error {
+	defer func(from *Element) { p.from = from }(p.from)
+	p.from = e
+	tok, lit := p.scan()
+	if p.Lenient && tok == directiveTok && contentKeywords[lit] == unknownModelType && p.onSameLine() {
+		p.warnf("unknown directive %s", lit)
+		tok, lit = p.scan()
+	}
+	if keyword := contentKeywords[lit]; tok == directiveTok && keyword != unknownModelType {
+		e.Content = ContentModel{modelType: keyword}
+		if tok, _ := p.scan(); indented && tok == indentTok {
+			return p.errorf(ContentConflict, e.Name, lit[1:]+" content")
+		}
+		p.unscan()
+		return nil
+	}
+	if indented && tok == arrowTok && p.onSameLine() {
+		if tok, _ = p.scan(); tok != indentTok {
+			p.unscan()
+			c, err := p.inline()
+			if err != nil {
+				return err
+			}
+			if tok, _ := p.scan(); tok == indentTok {
+				return p.errorf(ContentConflict, e.Name, "inline content")
+			}
+			p.unscan()
+			e.Content = *unwrap(c)
+			return nil
+		}
+	}
+	if !indented || tok != indentTok {
+		p.unscan()
+		if p.completing == e {
+			return p.errorf(DuplicateElement, e.Name)
+		}
+		if len(e.Attrs) > 0 {
+			p.attrsOnly[e] = true
+		}
+		e.Content = ContentModel{modelType: pcdataModelType}
+		return nil
+	}
+	c, err := p.list(dedentTok)
+	if err != nil {
+		return err
+	}
+	e.Content = *unwrap(c)
+	return nil
 }
 
+// entity parses the definition of the parameter entity name, whose %name has
+// been read: an '=' and then inline content.
+func (p *Parser) entity(name string) error {
+	if _, ok := p.entities[name]; ok {
+		return p.errorf(DuplicateEntity, name)
+	}
+	e := p.entityRefs[name]
+	if e != nil {
+		delete(p.entityRefs, name)
+	} else {
+		e = &Entity{Name: name}
+		p.entityList = append(p.entityList, e)
+	}
+	e.line, e.col = p.pos()
+	p.entities[name] = e
+
+	if tok, lit := p.scan(); tok != equalsTok {
+		return p.unexpected(tok, lit, "'=' after %"+name)
+	}
+	c, err := p.inline()
+	if err != nil {
+		return err
+	}
+	e.Content = *unwrap(c)
+	return nil
+}
+
+// entityRef returns the parameter entity a reference to name at line and col
+// points to, which is a placeholder until its definition has been read.
+func (p *Parser) entityRef(name string, line, col int) *Entity {
+	if e, ok := p.entities[name]; ok {
+		return e
+	}
+	if e, ok := p.entityRefs[name]; ok {
+		return e
+	}
+	e := &Entity{Name: name, line: line, col: col}
+	p.entityRefs[name] = e
+	p.entityList = append(p.entityList, e)
+	return e
+}
+
+// checkEntities reports the first parameter entity that is never defined, and
+// then the first whose content refers back to it, directly or through other
+// entities.
+func (p *Parser) checkEntities() error {
+	for _, e := range p.entityList {
+		if _, ok := p.entityRefs[e.Name]; ok {
+			return p.errorAt(e.line, e.col, UndefinedEntity, e.Name)
+		}
+	}
+	for _, e := range p.entityList {
+		if refersTo(&e.Content, e, map[*Entity]bool{}) {
+			return p.errorAt(e.line, e.col, CyclicEntity, e.Name)
+		}
+	}
+	return nil
+}
+
+// refersTo reports whether c refers to the entity target, directly or
+// through the content of the entities it refers to.  Entities in seen have
+// already been searched.
+func refersTo(c *ContentModel, target *Entity, seen map[*Entity]bool) bool {
+	if c.modelType == entityModelType {
+		if c.entity == target {
+			return true
+		}
+		if seen[c.entity] {
+			return false
+		}
+		seen[c.entity] = true
+	}
+	for _, child := range c.children {
+		if refersTo(child, target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// unwrap returns the content model of an element with the children of g.
+// When the only child is a parenthesized group, that group is the model.
+func unwrap(g *ContentModel) *ContentModel {
+	if len(g.children) == 1 && isGroup(g.children[0]) {
+		return g.children[0]
+	}
+	return g
+}
+
+// attributes parses the name=type pairs that follow an element name on its
+// line.  A name is known to start an attribute only by the '=' after it.
+func (p *Parser) attributes(e *Element) error {
+	for {
+		tok, name := p.scan()
+		if tok != identifierTok || !p.onSameLine() {
+			p.unscan()
+			return nil
+		}
+		line, col := p.pos()
+		if tok, _ := p.scan(); tok != equalsTok {
+			p.unscan()
+			p.unscan()
+			return nil
+		}
+		if strings.Count(name, ":") > 1 {
+			return p.errorAt(line, col, MalformedName, name)
+		}
+		a := Attribute{Name: name, Type: inferType(name), Occur: implied}
+		switch tok, lit := p.scan(); {
+		case !p.onSameLine():
+			p.unscan()
+			a.TypeInferred = true
+		case tok == directiveTok && !isOccur(lit) && contentKeywords[lit] == unknownModelType:
+			a.Type = strings.TrimPrefix(lit, "#")
+			if p.Lenient && !atomicTypes[a.Type] {
+				p.warnf("unknown directive %s, attribute %s is CDATA", lit, name)
+				a.Type = "CDATA"
+			}
+		case tok == openTok:
+			typ, err := p.enumeration()
+			if err != nil {
+				return err
+			}
+			a.Type = typ
+		case tok == identifierTok && lit == "NOTATION" && p.nextIs(openTok):
+			p.scan()
+			typ, err := p.enumeration()
+			if err != nil {
+				return err
+			}
+			a.Type = "NOTATION " + typ
+		default:
+			p.unscan()
+			a.TypeInferred = true
+		}
+		if p.nextIs(targetTok) {
+			p.scan()
+			if p.version == "1.0" {
+				return p.errorf(UnsupportedFeature, "an IDREF target", "1.1")
+			}
+			tok, lit := p.scan()
+			if tok != identifierTok || !p.onSameLine() {
+				return p.unexpected(tok, lit, "element name after ->")
+			}
+			a.Target = lit
+		}
+		if p.nextOnLine() {
+			if err := p.occurrence(&a); err != nil {
+				return err
+			}
+		}
+		a.DefPos = p.span(line, col)
+		if p.CheckReserved {
+			p.reserved(a)
+		}
+		if err := e.AddAttribute(a); err != nil {
+			return p.positioned(err.Error())
+		}
+		if p.handler != nil {
+			p.handler.Attribute(e.Name, a)
+		}
+	}
+}
+
+// reserved warns about each value of the attribute a that begins with xml,
+// in any case: those of an enumeration and those of the default of an
+// NMTOKEN or NMTOKENS attribute.
+func (p *Parser) reserved(a Attribute) {
+	var values []string
+	switch {
+	case isEnumeration(a.Type):
+		values = enumValues(a.Type)
+	case a.Type == "NMTOKEN" || a.Type == "NMTOKENS":
+		values = strings.Fields(a.Default)
+	}
+	for _, v := range values {
+		if len(v) >= 3 && strings.EqualFold(v[:3], "xml") {
+			p.warnf("line %d, col %d: value %s of attribute %s begins with xml, which is reserved", a.DefPos.Line, a.DefPos.Col, v, a.Name)
+		}
+	}
+}
+
+// occurrence parses the default declaration that may follow the type of a:
+// #REQUIRED, #IMPLIED, #FIXED and a quoted value, or just a quoted value,
+// which leaves a without a qualifier.  A quoted value after #REQUIRED or
+// #IMPLIED is taken as the default, for Validate to reject.  The qualifier
+// of a plain default stays "" rather than #IMPLIED, since a DTD writes that
+// default alone, as in x CDATA "a", and #IMPLIED with a default is the
+// mistake Validate rejects; without a default "" is written as #IMPLIED.
+func (p *Parser) occurrence(a *Attribute) error {
+	switch tok, lit := p.scan(); {
+	case tok == quoteTok:
+		a.Occur, a.Default = "", lit
+	case tok == directiveTok && Occur(lit) == fixed:
+		a.Occur = fixed
+		next, value := p.scan()
+		if next != quoteTok {
+			return p.unexpected(next, value, "quoted value after #FIXED")
+		}
+		a.Default = value
+	case tok == directiveTok && isOccur(lit):
+		a.Occur = Occur(lit)
+		if next, value := p.scan(); next == quoteTok {
+			a.Default = value
+		} else {
+			p.unscan()
+		}
+	default:
+		p.unscan()
+	}
+	return nil
+}
+
+// enumeration parses the values of an enumerated attribute type after its
+// '(' and returns the type as it is written in a DTD, like (left|right).
+func (p *Parser) enumeration() (string, error) {
+	var values []string
+	for {
+		tok, lit := p.scan()
+		if tok != identifierTok {
+			return "", p.unexpected(tok, lit, "enumeration value")
+		}
+		values = append(values, lit)
+		switch tok, lit := p.scan(); {
+		case tok == closeTok:
+			return "(" + strings.Join(values, "|") + ")", nil
+		case tok != separatorTok || lit != "|":
+			return "", p.unexpected(tok, lit, "'|' or ')'")
+		}
+	}
+}
+
+// list parses the particles of a group up to the end token, which is ')' in
+// parentheses or the dedent that closes indented children.
+func (p *Parser) list(end lexer.TokenType) (*ContentModel, error) {
+	g := &ContentModel{modelType: groupModelType}
+	sep := ""
+	for {
+		tok, lit := p.scan()
+		switch {
+		case tok == separatorTok && len(g.children) == 0:
+			return nil, p.errorf(LeadingSeparator, lit)
+		case tok == separatorTok:
+			return nil, p.errorf(DoubleSeparator, lit)
+		case tok == end && len(g.children) > 0:
+			p.unscan() // the error is at the separator
+			return nil, p.errorf(TrailingSeparator, sep)
+		}
+		c, err := p.particle(tok, lit, end == dedentTok)
+		if err != nil {
+			return nil, err
+		}
+		g.children = append(g.children, c)
+
+		switch tok, lit := p.scan(); {
+		case tok == end:
+			g.join(sep)
+			return g, nil
+		case tok == separatorTok:
+			if sep != "" && sep != lit {
+				return nil, p.errorf(MixedSeparators, lit, sep)
+			}
+			sep = lit
+		case end == dedentTok && !p.onSameLine():
+			p.unscan() // a new line separates indented particles
+		case end == dedentTok:
+			return nil, p.unexpected(tok, lit, "separator or end of line")
+		default:
+			return nil, p.unexpected(tok, lit, "separator or ')'")
+		}
+	}
+}
+
+// inline parses the content after '=>' on a definition line: particles
+// joined by separators, up to the first token that is not a separator.
+func (p *Parser) inline() (*ContentModel, error) {
+	g := &ContentModel{modelType: groupModelType}
+	sep := ""
+	for {
+		tok, lit := p.scan()
+		switch {
+		case tok == separatorTok && len(g.children) == 0:
+			return nil, p.errorf(LeadingSeparator, lit)
+		case tok == separatorTok:
+			return nil, p.errorf(DoubleSeparator, lit)
+		case len(g.children) > 0 && !p.onSameLine():
+			p.unscan() // the error is at the separator
+			return nil, p.errorf(TrailingSeparator, sep)
+		}
+		c, err := p.particle(tok, lit, false)
+		if err != nil {
+			return nil, err
+		}
+		g.children = append(g.children, c)
+
+		tok, lit = p.scan()
+		if tok != separatorTok {
+			p.unscan()
+			g.join(sep)
+			return g, nil
+		}
+		if sep != "" && sep != lit {
+			return nil, p.errorf(MixedSeparators, lit, sep)
+		}
+		sep = lit
+	}
+}
+
+// join sets the type of the group g from the separator between its
+// particles.  Without one, several particles on indented lines make a
+// sequence.
+func (g *ContentModel) join(sep string) {
+	switch {
+	case sep == "|":
+		g.modelType = choiceModelType
+	case sep == "&":
+		g.modelType = allModelType
+	case len(g.children) > 1:
+		g.modelType = sequenceModelType
+	}
+}
+
+// particle parses one particle of content whose first token has been read.
+func (p *Parser) particle(tok lexer.TokenType, lit string, indented bool) (*ContentModel, error) {
+	switch {
+	case tok == directiveTok && lit == "#PCDATA", tok == identifierTok && lit == "PCDATA":
+		return &ContentModel{modelType: pcdataModelType, multiplicity: p.modifier()}, nil
+	case tok == identifierTok:
+		if err := p.checkName(lit); err != nil {
+			return nil, err
+		}
+		c := &ContentModel{modelType: elementModelType}
+		line, col := p.pos()
+		if p.from != nil && p.nextIs(equalsTok) {
+			return nil, p.errorAt(line, col, AttributeAfterContent, lit, p.from.Name)
+		}
+		if next, _ := p.scan(); next == referenceTok {
+			c.element = p.reference(lit, line, col)
+			c.reference = true
+			c.multiplicity = p.modifier()
+			p.referenced(lit, c.multiplicity, line, col)
+			if p.handler != nil {
+				from := ""
+				if p.from != nil {
+					from = p.from.Name
+				}
+				p.handler.Reference(from, lit)
+			}
+			return c, nil
+		}
+		p.unscan()
+		c.multiplicity = p.modifier()
+		_, referenced := p.refs[lit]
+		e, err := p.declare(lit, line, col)
+		if err != nil {
+			return nil, err
+		}
+		if m := p.modifier(); m != singleMultiplicity {
+			if c.multiplicity != singleMultiplicity {
+				return nil, p.errorf(DoubleModifier, lit)
+			}
+			c.multiplicity = m
+		}
+		c.element = e
+		p.referenced(lit, c.multiplicity, line, col)
+		if err := p.content(e, indented); err != nil {
+			return nil, err
+		}
+		p.defined(e, line, col, referenced)
+		return c, nil
+	case tok == entityTok:
+		line, col := p.pos()
+		e := p.entityRef(lit, line, col)
+		c := &ContentModel{modelType: entityModelType, entity: e, children: []*ContentModel{&e.Content}}
+		c.multiplicity = p.modifier()
+		return c, nil
+	case tok == openTok:
+		c, err := p.list(closeTok)
+		if err != nil {
+			return nil, err
+		}
+		c.multiplicity = p.modifier()
+		return c, nil
+	}
+	return nil, p.unexpected(tok, lit, "element, reference or group")
+}
+
+// referenced calls OnReference, if set, for the element name that the
+// content being read names with the modifier m at line and col.  With
+// CheckMultiplicity it warns when that content named the element before
+// with another modifier.
+func (p *Parser) referenced(name string, m multiplicity, line, col int) {
+	if p.OnReference != nil {
+		p.OnReference(p.from, name, string(m))
+	}
+	if !p.CheckMultiplicity || p.from == nil {
+		return
+	}
+	named := p.named[p.from]
+	if named == nil {
+		named = map[string]multiplicity{}
+		p.named[p.from] = named
+	}
+	if first, ok := named[name]; !ok {
+		named[name] = m
+	} else if first != m {
+		p.warnf("line %d, col %d: the content of %s names %s as %s and as %s", line, col, p.from.Name, name, name+string(first), name+string(m))
+	}
+}
+
+// modifier returns the multiplicity that follows a particle, if any.
+func (p *Parser) modifier() multiplicity {
+	if tok, lit := p.scan(); tok == multiplicityTok {
+		return multiplicity(lit)
+	}
+	p.unscan()
+	return singleMultiplicity
+}
+
+// reference returns the element a reference to name at line and col points
+// to.  Before its definition has been read that is a placeholder the
+// definition fills in.
+func (p *Parser) reference(name string, line, col int) *Element {
+	if e, ok := p.elements[name]; ok {
+		return e
+	}
+	if e, ok := p.refs[name]; ok {
+		return e
+	}
+	e := &Element{Name: name, line: line, col: col}
+	p.refs[name] = e
+	return e
+}
+
+// checkName returns an error if the element name just read is not a name or
+// a qualified name with one colon, such as html:body.
+func (p *Parser) checkName(name string) error {
+	if strings.Count(name, ":") > 1 {
+		return p.errorf(MalformedName, name)
+	}
+	return nil
+}
+
+// contentKeywords are the directives that give the whole content model of an
+// element in place of its children.
+var contentKeywords = map[string]modelType{
+	"#EMPTY": emptyModelType,
+	"#ANY":   anyModelType,
+}
+
+// isGroup reports whether c is a parenthesized group rather than a particle.
+func isGroup(c *ContentModel) bool {
+	switch c.modelType {
+	case groupModelType, sequenceModelType, choiceModelType, allModelType:
+		return true
+	}
+	return false
+}
+
+// errorf returns the parser error of the given kind.
+func (p *Parser) errorf(kind ErrorKind, args ...interface{}) error {
+	return p.positioned(p.Messages.format(kind, args...))
+}
+
+// errorAt returns the parser error of the given kind at line and col.
+func (p *Parser) errorAt(line, col int, kind ErrorKind, args ...interface{}) error {
+	return fmt.Errorf("line %d, col %d: %s", line, col, p.Messages.format(kind, args...))
+}
+
+// pos returns the line and column of the last token read and not pushed
+// back.  The buffer keeps one token more than unscan can push back.
+func (p *Parser) pos() (int, int) {
+	n := p.buf.n
+	if n >= len(p.buf.tok) {
+		n = len(p.buf.tok) - 1
+	}
+	tok := p.buf.tok[n]
+	return tok.Line, tok.Col
+}
+
+// span returns the position from line and col to the end of the last token
+// read and not pushed back, other than an indent, a dedent or the end of
+// input.
+func (p *Parser) span(line, col int) Position {
+	n := p.buf.n
+	if n >= len(p.buf.last) {
+		n = len(p.buf.last) - 1
+	}
+	last := p.buf.last[n]
+	return Position{Line: line, Col: col, EndLine: last.EndLine, EndCol: last.EndCol}
+}
+
+// nextIs reports whether the next token is of type tok on the line of the
+// last one read, and leaves it to be read.
+func (p *Parser) nextIs(tok lexer.TokenType) bool {
+	next, _ := p.scan()
+	defer p.unscan()
+	return next == tok && p.onSameLine()
+}
+
+// nextOnLine reports whether the next token is on the line of the last one
+// read, and leaves it to be read.
+func (p *Parser) nextOnLine() bool {
+	p.scan()
+	defer p.unscan()
+	return p.onSameLine()
+}
+
+// onSameLine reports whether the token just read is on the line of the one
+// read before it.  A dedent starts a line, and so does the end of input.
+func (p *Parser) onSameLine() bool {
+	tok, prev := p.buf.tok[p.buf.n], p.buf.tok[p.buf.n+1]
+	return tok.Line == prev.Line && prev.Type != dedentTok && tok.Type != eofTok
+}
+
+// positioned returns msg as an error at the position of the last token read,
+// as in "line 3, col 12: Runaway quote".  Before any token there is none.
+func (p *Parser) positioned(msg string) error {
+	if line, col := p.pos(); line > 0 {
+		return fmt.Errorf("line %d, col %d: %s", line, col, msg)
+	}
+	return errors.New(msg)
+}
+
+// unexpected returns the error for a token out of place in content.  A
+// scanner error is returned as it is.
+func (p *Parser) unexpected(tok lexer.TokenType, lit, expected string) error {
+	switch tok {
+	case lexer.ErrorTok:
+		return p.positioned(lit)
+	case eofTok:
+		lit = "end of input"
+	case indentTok:
+		lit = "indent"
+	case dedentTok:
+		lit = "dedent"
+	default:
+		lit = strconv.Quote(lit)
+	}
+	return p.errorf(ExpectedToken, lit, expected)
+}
+
+// scan returns the next token, either pushed back by unscan or read from the
+// lexer.  Warnings go to the Warn sink and comments to comment.  Once the
+// lexer has finished, every scan returns eofTok.
 func (p *Parser) scan() (lexer.TokenType, string) {
-	token := p.s.NextToken()
+	if p.buf.n > 0 {
+		p.buf.n--
+		tok := p.buf.tok[p.buf.n]
+		return tok.Type, tok.Value
+	}
+	token := p.s.NextTokenSync()
+	for token != nil && (token.Type == lexer.WarningTok || token.Type == commentTok) {
+		if token.Type == lexer.WarningTok {
+			p.warnf("%s", token.Value)
+		} else {
+			p.countBlanks(*token)
+			p.comment(*token)
+		}
+		token = p.s.NextTokenSync()
+	}
+	if token != nil {
+		p.countBlanks(*token)
+	}
+	if token == nil { // the lexer has finished, so stay at the end
+		last := p.buf.tok[0]
+		token = &lexer.Token{Type: eofTok, Line: last.Line, Col: last.Col}
+	}
+	copy(p.buf.tok[1:], p.buf.tok[:])
+	p.buf.tok[0] = *token
+	copy(p.buf.last[1:], p.buf.last[:])
+	if t := token.Type; t != indentTok && t != dedentTok && t != eofTok {
+		p.buf.last[0] = *token
+	}
 	return token.Type, token.Value
 }
 
-// unscan pushes the previously read token back onto the buffer.
-func (p *Parser) unscan() { p.buf.n = 1 }
+// countBlanks notes the number of blank lines before the line of tok when
+// it is the first token read on that line.  Those before the first line do
+// not count.
+func (p *Parser) countBlanks(tok lexer.Token) {
+	if n := tok.Line - p.lastLine - 1; n > 0 && p.lastLine > 0 {
+		p.blanks[tok.Line] = n
+	}
+	if tok.Line > p.lastLine {
+		p.lastLine = tok.Line
+	}
+}
+
+// comment keeps the text of a comment token for the definition it documents.
+// A comment after other tokens on its line belongs to the first element
+// defined on that line, if any.  Comments on lines of their own collect into
+// a block that the definition on the line right after it takes, so a blank
+// line in between leaves the block unattached.
+func (p *Parser) comment(tok lexer.Token) {
+	if fields := strings.Fields(tok.Value); tok.Line == 1 && len(fields) == 2 && fields[0] == "#dtdx" {
+		p.pragma(fields[1])
+		return
+	}
+	text := strings.TrimSpace(strings.TrimPrefix(tok.Value, "#"))
+	if last := p.buf.tok[0]; last.Line == tok.Line && last.Type != indentTok && last.Type != dedentTok {
+		if e := p.lineDef; e != nil && e.line == tok.Line {
+			e.Doc = append(e.Doc, text)
+		} else {
+			p.trail, p.trailLine = text, tok.Line
+		}
+		return
+	}
+	if p.docLine != tok.Line-1 {
+		p.doc = nil
+	}
+	p.doc = append(p.doc, text)
+	p.docLine = tok.Line
+}
+
+// dtdxVersions are the versions of DTDX that a #dtdx line may declare, the
+// latest last.
+var dtdxVersions = []string{"1.0", "1.1"}
+
+// pragma reads the version declared by the #dtdx line of a file.
+func (p *Parser) pragma(version string) {
+	for _, known := range dtdxVersions {
+		if version == known {
+			p.version = version
+			return
+		}
+	}
+	p.warnf("unknown version #dtdx %s, read as %s", version, dtdxVersions[len(dtdxVersions)-1])
+}
+
+// splitDocs moves the structured comments of e, like @desc: text, from Doc
+// to Docs under their key.  The other comments stay in Doc.
+func (e *Element) splitDocs() {
+	plain := e.Doc[:0]
+	for _, line := range e.Doc {
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "@"), ":")
+		if !strings.HasPrefix(line, "@") || !ok || !isName(key) {
+			plain = append(plain, line)
+			continue
+		}
+		if e.Docs == nil {
+			e.Docs = map[string]string{}
+		}
+		e.Docs[key] = strings.TrimSpace(value)
+	}
+	if len(plain) == 0 {
+		plain = nil
+	}
+	e.Doc = plain
+}
+
+// unscan pushes the previously read token back onto the buffer.  Calling it
+// twice pushes back the two most recent tokens.
+func (p *Parser) unscan() { p.buf.n++ }
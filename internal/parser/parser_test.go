@@ -0,0 +1,1150 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adobrowolski/dtdx/internal/lexer"
+)
+
+func TestWarnSink(t *testing.T) {
+	var got []Diagnostic
+	p := NewParser(strings.NewReader(""))
+	p.Warn = func(d Diagnostic) { got = append(got, d) }
+
+	p.warnf("unknown directive %s", "#BOGUS")
+	if len(got) != 1 || got[0].Msg != "unknown directive #BOGUS" {
+		t.Fatalf("Expected one warning about #BOGUS, but found %v", got)
+	}
+	if s := got[0].String(); s != "warning: unknown directive #BOGUS" {
+		t.Errorf("Expected warning prefix, but found %q", s)
+	}
+}
+
+func TestWarnLenientDirective(t *testing.T) {
+	var got []string
+	p := NewParser(strings.NewReader("a icon=#URI #BOGUS\n  b"))
+	p.Lenient = true
+	p.Warn = func(d Diagnostic) { got = append(got, d.String()) }
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "warning: unknown directive #URI, attribute icon is CDATA|warning: unknown directive #BOGUS"
+	if s := strings.Join(got, "|"); s != expect {
+		t.Errorf("Expected warnings %q, but found %q", expect, s)
+	}
+	if root.Attrs[0].Type != "CDATA" || names(&root.Content) != "(b)" {
+		t.Errorf("Expected a CDATA icon and the content (b), but found %v and %s", root.Attrs, names(&root.Content))
+	}
+
+	p = NewParser(strings.NewReader("a icon=#URI"))
+	if _, err := p.Parse(); err == nil {
+		t.Errorf("Expected #URI to be an error unless the parser is lenient")
+	}
+}
+
+func TestWarnReserved(t *testing.T) {
+	const src = "a space=(default|XMLfoo) size=(small|large) token=#NMTOKEN \"xmlns\""
+	var got []string
+	p := NewParser(strings.NewReader(src))
+	p.CheckReserved = true
+	p.Warn = func(d Diagnostic) { got = append(got, d.Msg) }
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	expect := "line 1, col 3: value XMLfoo of attribute space begins with xml, which is reserved|" +
+		"line 1, col 45: value xmlns of attribute token begins with xml, which is reserved"
+	if s := strings.Join(got, "|"); s != expect {
+		t.Errorf("Expected warnings %q, but found %q", expect, s)
+	}
+
+	got = nil
+	p = NewParser(strings.NewReader(src))
+	p.Warn = func(d Diagnostic) { got = append(got, d.Msg) }
+	if _, err := p.Parse(); err != nil || len(got) > 0 {
+		t.Errorf("Expected no warnings unless CheckReserved is set, but found %v, %v", got, err)
+	}
+}
+
+func TestWarnMultiplicity(t *testing.T) {
+	const src = "page\n  line+\n  title\n  line...?\n  line...+\n"
+	var got []string
+	p := NewParser(strings.NewReader(src))
+	p.CheckMultiplicity = true
+	p.Warn = func(d Diagnostic) { got = append(got, d.Msg) }
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	expect := "line 4, col 3: the content of page names line as line+ and as line?"
+	if s := strings.Join(got, "|"); s != expect {
+		t.Errorf("Expected warnings %q, but found %q", expect, s)
+	}
+
+	got = nil
+	p = NewParser(strings.NewReader(src))
+	p.Warn = func(d Diagnostic) { got = append(got, d.Msg) }
+	if _, err := p.Parse(); err != nil || len(got) > 0 {
+		t.Errorf("Expected no warnings unless CheckMultiplicity is set, but found %v, %v", got, err)
+	}
+}
+
+func TestWarnRedundant(t *testing.T) {
+	const src = "doc\n  title...\n  line...\n  note...\ntitle => PCDATA\nline #EMPTY\nnote => (PCDATA | title...)*\n"
+	var got []string
+	p := NewParser(strings.NewReader(src))
+	p.CheckRedundant = true
+	p.Warn = func(d Diagnostic) { got = append(got, d.Msg) }
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	expect := "line 5, col 1: element title is defined as (#PCDATA), which its references already make it"
+	if s := strings.Join(got, "|"); s != expect {
+		t.Errorf("Expected warnings %q, but found %q", expect, s)
+	}
+
+	got = nil
+	p = NewParser(strings.NewReader(src))
+	p.Warn = func(d Diagnostic) { got = append(got, d.Msg) }
+	if _, err := p.Parse(); err != nil || len(got) > 0 {
+		t.Errorf("Expected no warnings unless CheckRedundant is set, but found %v, %v", got, err)
+	}
+}
+
+func TestWarnDiscardedByDefault(t *testing.T) {
+	p := NewParser(strings.NewReader(""))
+	p.warnf("dropped") // must not panic without a sink
+}
+
+func TestReset(t *testing.T) {
+	var warnings int
+	p := NewParser(strings.NewReader("first"))
+	p.Warn = func(Diagnostic) { warnings++ }
+	p.elements["first"] = &Element{Name: "first"}
+	p.order = append(p.order, "first")
+	p.unscan()
+
+	p.Reset(strings.NewReader("second"))
+	if len(p.elements) != 0 || len(p.order) != 0 || p.buf.n != 0 {
+		t.Errorf("Expected no state after Reset, but found %v %v %d", p.elements, p.order, p.buf.n)
+	}
+	p.warnf("kept")
+	if warnings != 1 {
+		t.Errorf("Expected the Warn sink to survive Reset")
+	}
+}
+
+func TestScanUnscan(t *testing.T) {
+	p := NewParser(strings.NewReader("a b"))
+	scan := func(expectTok lexer.TokenType, expectLit string) {
+		t.Helper()
+		if tok, lit := p.scan(); tok != expectTok || lit != expectLit {
+			t.Errorf("Expected %v %q, but found %v %q", expectTok, expectLit, tok, lit)
+		}
+	}
+	scan(identifierTok, "a")
+	p.unscan()
+	scan(identifierTok, "a")
+	scan(identifierTok, "b")
+	p.unscan()
+	p.unscan()
+	if line, col := p.pos(); line != 0 || col != 0 {
+		t.Errorf("Expected no position before the first token, but found %d:%d", line, col)
+	}
+	scan(identifierTok, "a")
+	scan(identifierTok, "b")
+	scan(eofTok, "")
+	scan(eofTok, "") // past the end of the token stream
+	p.unscan()
+	scan(eofTok, "")
+}
+
+func TestParserMessages(t *testing.T) {
+	p := NewParser(strings.NewReader(""))
+	if err := p.errorf(UnexpectedToken, "="); err.Error() != `found "=", expected element identifier` {
+		t.Errorf("Expected the default message, but found %q", err)
+	}
+	p.Messages = Messages{UnexpectedToken: "unexpected %s"}
+	if err := p.errorf(UnexpectedToken, "="); err.Error() != "unexpected =" {
+		t.Errorf("Expected the custom message, but found %q", err)
+	}
+}
+
+// names renders a content model with plain element names.
+func names(c *ContentModel) string {
+	return c.render(func(e *Element) string { return e.Name })
+}
+
+func TestElementNames(t *testing.T) {
+	src := "paragraph\n" +
+		"\ttitle?\n" +
+		"\tline...+\n" +
+		"\tnote...\n" +
+		"\n" +
+		"line\n" +
+		"\t(PCDATA, bold)*\n"
+	p := NewParser(strings.NewReader(src))
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	names := p.ElementNames()
+	if got := strings.Join(names, " "); got != "paragraph title line bold" {
+		t.Errorf("Expected paragraph title line bold, but found %s", got)
+	}
+	names[0] = "changed"
+	if p.ElementNames()[0] != "paragraph" {
+		t.Errorf("Expected ElementNames to return a copy")
+	}
+	for name, defined := range map[string]bool{"paragraph": true, "bold": true, "note": false, "figure": false} {
+		if got := p.IsDefined(name); got != defined {
+			t.Errorf("Expected IsDefined(%s) to be %v, but found %v", name, defined, got)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	p := NewParser(strings.NewReader(test1 + "\nnote ref=#IDREF->line\n"))
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Rename("line", "textline"); err != nil {
+		t.Fatal(err)
+	}
+	if p.IsDefined("line") || !p.IsDefined("textline") {
+		t.Errorf("Expected textline to be defined in place of line, but found %v", p.ElementNames())
+	}
+	if got, expect := strings.Join(p.ElementNames(), " "), "paragraph title textline bold note"; got != expect {
+		t.Errorf("Expected the names %s, but found %s", expect, got)
+	}
+	if got, expect := names(&root.Content), "(title?, textline+)"; got != expect {
+		t.Errorf("Expected the content %s, but found %s", expect, got)
+	}
+	if got := p.elements["note"].Attrs[0].Target; got != "textline" {
+		t.Errorf("Expected the target textline, but found %s", got)
+	}
+
+	for _, tC := range []struct{ old, new, expect string }{
+		{"textline", "title", "rename textline: element title already exists"},
+		{"textline", "bold", "rename textline: element bold already exists"},
+		{"textline", "1line", `rename textline: "1line" is not a legal element name`},
+		{"textline", "a:b:c", `rename textline: "a:b:c" is not a legal element name`},
+		{"line", "verse", "rename line: no such element"},
+	} {
+		if err := p.Rename(tC.old, tC.new); err == nil || err.Error() != tC.expect {
+			t.Errorf("Expected error %q, but found %v", tC.expect, err)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	const body = "a ref=#IDREF->b\n  b\n"
+	for _, tC := range []struct{ src, expect, warnings string }{
+		{"#dtdx 1.1\n" + body, "", ""},
+		{body, "", ""},
+		{"#dtdx 1.0\n" + body, "line 2, col 13: an IDREF target needs #dtdx 1.1 or later", ""},
+		{"#dtdx 1.0\na id=\n", "", ""},
+		{"#dtdx 2.0\n" + body, "", "unknown version #dtdx 2.0, read as 1.1"},
+		{"# A comment\n#dtdx 1.0\n" + body, "", ""},
+	} {
+		var warnings []string
+		p := NewParser(strings.NewReader(tC.src))
+		p.Warn = func(d Diagnostic) { warnings = append(warnings, d.Msg) }
+		root, err := p.Parse()
+		switch {
+		case tC.expect == "" && err != nil:
+			t.Errorf("%q: %v", tC.src, err)
+		case tC.expect != "" && (err == nil || err.Error() != tC.expect):
+			t.Errorf("%q: expected error %q, but found %v", tC.src, tC.expect, err)
+		case err == nil && len(root.Doc) > 0 && strings.HasPrefix(tC.src, "#dtdx"):
+			t.Errorf("%q: expected the #dtdx line to be no comment, but found %v", tC.src, root.Doc)
+		}
+		if got := strings.Join(warnings, "|"); got != tC.warnings {
+			t.Errorf("%q: expected warnings %q, but found %q", tC.src, tC.warnings, got)
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	const src = "%inline = bold | %font\n%font = italic\n%block = list | table\npara => (PCDATA | %inline)*\n"
+	p := NewParser(strings.NewReader(src))
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []EntityUse{{"inline", true}, {"font", true}, {"block", false}}
+	got := p.Manifest()
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Errorf("Expected %v, but found %v", expect, got)
+	}
+}
+
+func TestParseEmptyDocument(t *testing.T) {
+	for _, src := range []string{"", "\n\n", "# only a comment\n\n# and another\n", "%inline = b | i\n"} {
+		root, err := NewParser(strings.NewReader(src)).Parse()
+		if expect := "document has no element definition"; root != nil || err == nil || err.Error() != expect {
+			t.Errorf("Expected error %q for %q, but found %v and %v", expect, src, root, err)
+		}
+	}
+	root, err := NewParser(strings.NewReader("# A comment first.\n\n\n# Then a definition.\ndoc\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Name != "doc" || len(root.Doc) != 1 || root.Doc[0] != "Then a definition." {
+		t.Errorf("Expected root doc after the comments, but found %s %q", root.Name, root.Doc)
+	}
+}
+
+func TestParseDocExample(t *testing.T) {
+	src := "# The first top level definition.\n" +
+		"paragraph\n" +
+		"\t# A definition with two references nested inside paragraph.\n" +
+		"\ttitle?\n" +
+		"\tline...+\n" +
+		"\n" +
+		"# A second top level definition.\n" +
+		"line\n" +
+		"\t(PCDATA, bold)*\n"
+	p := NewParser(strings.NewReader(src))
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Name != "paragraph" {
+		t.Errorf("Expected root paragraph, but found %s", root.Name)
+	}
+	expect := map[string]string{
+		"paragraph": "(title?, line+)",
+		"title":     "(#PCDATA)",
+		"line":      "(#PCDATA, bold)*",
+		"bold":      "(#PCDATA)",
+	}
+	for name, model := range expect {
+		if got := names(&p.elements[name].Content); got != model {
+			t.Errorf("Expected %s %s, but found %s", name, model, got)
+		}
+	}
+	if got := strings.Join(p.order, " "); got != "paragraph title line bold" {
+		t.Errorf("Expected definition order paragraph title line bold, but found %s", got)
+	}
+	if line := root.Content.children[1].element; line != p.elements["line"] {
+		t.Errorf("Expected the line reference to resolve to its definition")
+	}
+}
+
+func TestParseNesting(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect string
+	}{
+		{"a\n  b\n    c\n    d*\n  e", "(b, e)"},
+		{"a\n  (b | c...)+", "(b | c)+"},
+		{"a\n  (b, (c | d)?)", "(b, (c | d)?)"},
+		{"a\n  b,\n  c", "(b, c)"},
+		{"a\n  b", "(b)"},
+		{"a\n  PCDATA\n  b", "(#PCDATA, b)"},
+		{"a\n  (#PCDATA | b)*", "(#PCDATA | b)*"},
+		{"a\n\t#PCDATA", "(#PCDATA)"},
+		{"a\n  #PCDATA\n  b", "(#PCDATA, b)"},
+		{"a", "(#PCDATA)"},
+		{"a\n  b...", "(b)"},
+		{"a => (PCDATA, bold)*", "(#PCDATA, bold)*"},
+		{"a id= => b, c...?", "(b, c?)"},
+		{"a => b | c\nd", "(b | c)"},
+		{"a\n  b => c\n  d", "(b, d)"},
+		{"a #EMPTY", "EMPTY"},
+		{"a id= #ANY", "ANY"},
+		{"a\n  hr #EMPTY\n  b", "(hr, b)"},
+		{"a id=\n  (b | c)", "(b | c)"},
+		{"a\n  b id= *\n  c?", "(b*, c?)"},
+		{"a\n  b? id=\n  c +", "(b?, c+)"},
+		{"a\n  b id= uri= +\n    c ?", "(b+)"},
+		{"a\n  (b id= * | c)", "(b* | c)"},
+		{"a id= =>\n  b\n  c", "(b, c)"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			root, err := NewParser(strings.NewReader(tC.src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(&root.Content); got != tC.expect {
+				t.Errorf("Expected %s, but found %s", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestParseOneLineDefinitions(t *testing.T) {
+	for _, src := range []string{"a => (b|c)\n\nd => (e, f)*\n", "a => (b|c)\nd => (e, f)*"} {
+		p := NewParser(strings.NewReader(src))
+		root, err := p.Parse()
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		if root.Name != "a" || !p.IsDefined("d") {
+			t.Errorf("%q: expected a and d to be defined, but found %v", src, p.ElementNames())
+		}
+		got, err := p.ElementDTD("d")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := "<!ELEMENT d (e, f)*>\n"; got != expect {
+			t.Errorf("%q: expected %q, but found %q", src, expect, got)
+		}
+	}
+}
+
+func TestParseAttributesFirst(t *testing.T) {
+	src := "paragraph id=\n" +
+		"\n" +
+		"# The full definition.\n" +
+		"paragraph lang= => (title?)\n"
+	p := NewParser(strings.NewReader(src))
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(&root.Content); len(root.Attrs) != 2 || got != "(title?)" {
+		t.Errorf("Expected the attributes id and lang and the content (title?), but found %v and %s", root.Attrs, got)
+	}
+	if len(p.ElementNames()) != 2 {
+		t.Errorf("Expected two elements, but found %v", p.ElementNames())
+	}
+	got, err := p.ElementDTD("paragraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<!-- The full definition. -->\n" +
+		"<!ELEMENT paragraph (title?)>\n" +
+		"<!ATTLIST paragraph\n" +
+		"    id   ID    #IMPLIED\n" +
+		"    lang CDATA #IMPLIED\n" +
+		"    >\n"
+	if got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+
+	for _, src := range []string{"a x=\na y=", "a => b\na x=", "a x=\na => b\na => c"} {
+		if _, err := NewParser(strings.NewReader(src)).Parse(); err == nil || !strings.Contains(err.Error(), "defined more than once") {
+			t.Errorf("%q: expected a second definition to be an error, but found %v", src, err)
+		}
+	}
+}
+
+func TestParseOnReference(t *testing.T) {
+	var got []string
+	p := NewParser(strings.NewReader(test1 + "\n%inline = (em)\n"))
+	p.OnReference = func(from *Element, ref string, m string) {
+		name := "-"
+		if from != nil {
+			name = from.Name
+		}
+		got = append(got, name+"->"+ref+m)
+	}
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	expect := "paragraph->title? paragraph->line+ line->bold -->em"
+	if strings.Join(got, " ") != expect {
+		t.Errorf("Expected %s, but found %s", expect, strings.Join(got, " "))
+	}
+}
+
+func TestParseConcurrent(t *testing.T) {
+	const parsers = 8
+	var wg sync.WaitGroup
+	got := make([]string, parsers)
+	errs := make([]error, parsers)
+	for i := 0; i < parsers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			src := fmt.Sprintf("doc%d\n  head%d\n  body%d => (para%d | note%d...)*\nnote%d", i, i, i, i, i, i)
+			p := NewParser(strings.NewReader(src))
+			root, err := p.Parse()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			var defs []string
+			for _, e := range root.defs {
+				defs = append(defs, e.Name)
+			}
+			got[i] = fmt.Sprintf("%d %s", len(p.elements), strings.Join(defs, " "))
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < parsers; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		expect := fmt.Sprintf("5 doc%d head%d body%d para%d note%d", i, i, i, i, i)
+		if got[i] != expect {
+			t.Errorf("Expected parser %d to define only its own elements %q, but found %q", i, expect, got[i])
+		}
+	}
+}
+
+func TestParseForwardReference(t *testing.T) {
+	p := NewParser(strings.NewReader("a\n  b...*\nb\n  c\n  a...?"))
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := root.Content.children[0].element
+	if b != p.elements["b"] || names(&b.Content) != "(c, a?)" {
+		t.Errorf("Expected b to be its definition (c, a?), but found %s", names(&b.Content))
+	}
+	if len(p.refs) != 0 {
+		t.Errorf("Expected every reference to be defined, but found %v", p.refs)
+	}
+}
+
+func TestParseDefinitionPosition(t *testing.T) {
+	p := NewParser(strings.NewReader("a\n  (c*, d+)\n  b? id="))
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string][2]int{"a": {1, 1}, "b": {3, 3}, "c": {2, 4}, "d": {2, 8}}
+	for name, want := range expect {
+		if e := p.elements[name]; e.line != want[0] || e.col != want[1] {
+			t.Errorf("Expected %s at %d:%d, but found %d:%d", name, want[0], want[1], e.line, e.col)
+		}
+	}
+}
+
+func TestParseUndefinedReference(t *testing.T) {
+	p := NewParser(strings.NewReader("a\n  b..."))
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := p.refs["b"]
+	if !ok || names(&b.Content) != "(#PCDATA)" {
+		t.Errorf("Expected undefined b to default to (#PCDATA), but found %v", b)
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	root, err := NewParser(strings.NewReader("paragraph id= name= IDRefs= key=#IDREF idref=#CDATA\n  title")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDefPos(root)
+	expect := []Attribute{
+		{Name: "id", Type: "ID", Occur: implied, TypeInferred: true},
+		{Name: "name", Type: "CDATA", Occur: implied, TypeInferred: true},
+		{Name: "IDRefs", Type: "IDREFS", Occur: implied, TypeInferred: true},
+		{Name: "key", Type: "IDREF", Occur: implied},
+		{Name: "idref", Type: "CDATA", Occur: implied},
+	}
+	if len(root.Attrs) != len(expect) {
+		t.Fatalf("Expected %v, but found %v", expect, root.Attrs)
+	}
+	for i, a := range expect {
+		if root.Attrs[i] != a {
+			t.Errorf("Expected %v, but found %v", a, root.Attrs[i])
+		}
+	}
+	if got := names(&root.Content); got != "(title)" {
+		t.Errorf("Expected (title), but found %s", got)
+	}
+}
+
+func TestParseTypeInferred(t *testing.T) {
+	for src, expect := range map[string]Attribute{
+		"a id=":          {Name: "id", Type: "ID", Occur: implied, TypeInferred: true},
+		"a id=#CDATA":    {Name: "id", Type: "CDATA", Occur: implied},
+		"a id=#ID":       {Name: "id", Type: "ID", Occur: implied},
+		"a id=(x|y)":     {Name: "id", Type: "(x|y)", Occur: implied},
+		`a name= "x"`:    {Name: "name", Type: "CDATA", Default: "x", TypeInferred: true},
+		"a id=#REQUIRED": {Name: "id", Type: "ID", Occur: required, TypeInferred: true},
+	} {
+		root, err := NewParser(strings.NewReader(src)).Parse()
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		clearDefPos(root)
+		if root.Attrs[0] != expect {
+			t.Errorf("%q: expected %v, but found %v", src, expect, root.Attrs[0])
+		}
+	}
+}
+
+func TestParseEntities(t *testing.T) {
+	p := NewParser(strings.NewReader("a => (PCDATA | %inline)*\nb => %inline+\n%inline = (c | d)"))
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := root.Content.String(); got != "(#PCDATA | %inline;)*" {
+		t.Errorf("Expected (#PCDATA | %%inline;)*, but found %s", got)
+	}
+	if got := names(&root.Content); got != "(#PCDATA | (c | d))*" {
+		t.Errorf("Expected the entity to render as its content, but found %s", got)
+	}
+	b := p.elements["b"]
+	if got := b.Content.String(); got != "(%inline;+)" {
+		t.Errorf("Expected (%%inline;+), but found %s", got)
+	}
+	if e := p.entities["inline"]; e == nil || e.Content.String() != "(c | d)" {
+		t.Errorf("Expected %%inline to be (c | d), but found %v", e)
+	}
+	if p.elements["c"] == nil || b.IsEmptyAllowed() {
+		t.Errorf("Expected c to be defined by the entity and b to need content")
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	files := map[string]string{
+		"doc/main.dtdx":       "doc => (head, body...)\n#INCLUDE \"lib/common.dtdx\"\n",
+		"doc/lib/common.dtdx": "body => (para...)*\n#INCLUDE \"inline.dtdx\"\n",
+		"doc/lib/inline.dtdx": "%inline = (bold | italic)\npara => (PCDATA | %inline)*\n",
+		"loop/a.dtdx":         "a\n#INCLUDE \"b.dtdx\"\n",
+		"loop/b.dtdx":         "b\n#INCLUDE \"a.dtdx\"\n",
+		"dup/main.dtdx":       "doc\n  para\n#INCLUDE \"more.dtdx\"\n",
+		"dup/more.dtdx":       "list\npara\n",
+	}
+	parse := func(path string) (*Parser, *Element, error) {
+		p := NewParser(strings.NewReader(files[path]))
+		p.path = path
+		p.Resolve = func(path string) (io.Reader, error) {
+			src, ok := files[path]
+			if !ok {
+				return nil, fmt.Errorf("no such file %s", path)
+			}
+			return strings.NewReader(src), nil
+		}
+		root, err := p.Parse()
+		return p, root, err
+	}
+
+	p, root, err := parse("doc/main.dtdx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Name != "doc" || len(root.defs) != 6 {
+		t.Errorf("Expected root doc with 6 definitions, but found %s with %d", root.Name, len(root.defs))
+	}
+	if got := p.elements["body"].Content.String(); got != "(para)*" {
+		t.Errorf("Expected the included body to be (para)*, but found %s", got)
+	}
+	if p.entities["inline"] == nil || p.elements["bold"] == nil {
+		t.Errorf("Expected the nested include to define %%inline and bold")
+	}
+
+	errors := map[string]string{
+		"loop/a.dtdx":   "loop/b.dtdx: line 2, col 11: circular #INCLUDE of loop/a.dtdx",
+		"dup/main.dtdx": "dup/more.dtdx: line 2, col 1: element para is defined more than once",
+	}
+	for path, expect := range errors {
+		if _, _, err := parse(path); err == nil || err.Error() != expect {
+			t.Errorf("%s: expected error %q, but found %v", path, expect, err)
+		}
+	}
+	_, err = NewParser(strings.NewReader("a\n#INCLUDE \"b.dtdx\"")).Parse()
+	if expect := "line 2, col 11: cannot #INCLUDE b.dtdx without a resolver"; err == nil || err.Error() != expect {
+		t.Errorf("Expected error %q, but found %v", expect, err)
+	}
+}
+
+func TestParseLenientEllipsis(t *testing.T) {
+	var warnings []string
+	p := NewParser(strings.NewReader("a\n  b..\n#INCLUDE \"c.dtdx\""))
+	p.LenientEllipsis = true
+	p.Warn = func(d Diagnostic) { warnings = append(warnings, d.Msg) }
+	p.Resolve = func(string) (io.Reader, error) { return strings.NewReader("c => d...."), nil }
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	expect := `Reference ellipsis ".." should be exactly three dots.|Reference ellipsis "...." should be exactly three dots.`
+	if got := strings.Join(warnings, "|"); got != expect {
+		t.Errorf("Expected warnings %q, but found %q", expect, got)
+	}
+
+	p = NewParser(strings.NewReader("a\n  b.."))
+	if _, err := p.Parse(); err == nil {
+		t.Errorf("Expected b.. to be an error without LenientEllipsis")
+	}
+}
+
+func TestParseRefSuffix(t *testing.T) {
+	p := NewParser(strings.NewReader("a\n  b~*\n#INCLUDE \"b.dtdx\""))
+	p.RefSuffix = "~"
+	p.Resolve = func(string) (io.Reader, error) { return strings.NewReader("b => (c~ | a~)"), nil }
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(&root.Content); got != "(b*)" {
+		t.Errorf("Expected a to refer to b, but found %s", got)
+	}
+	if got := names(&p.elements["b"].Content); got != "(c | a)" {
+		t.Errorf("Expected the included b to refer to c and a, but found %s", got)
+	}
+}
+
+func TestParseIndentPolicy(t *testing.T) {
+	p := NewParser(strings.NewReader("a\n  b"))
+	p.IndentPolicy = TabsOnly
+	if _, err := p.Parse(); err == nil || err.Error() != "line 2, col 1: Indentation uses spaces but only tabs are allowed." {
+		t.Errorf("Expected spaces to be rejected, but found %v", err)
+	}
+
+	p = NewParser(strings.NewReader("a\n\tb\n#INCLUDE \"c.dtdx\""))
+	p.IndentPolicy = TabsOnly
+	p.path = "main.dtdx"
+	p.Resolve = func(string) (io.Reader, error) { return strings.NewReader("c\n  d"), nil }
+	if _, err := p.Parse(); err == nil || err.Error() != "c.dtdx: line 2, col 1: Indentation uses spaces but only tabs are allowed." {
+		t.Errorf("Expected spaces in the included file to be rejected, but found %v", err)
+	}
+}
+
+func TestParseIndentUnit(t *testing.T) {
+	var warnings []string
+	p := NewParser(strings.NewReader("a\n  b\nc\n    d\n#INCLUDE \"e.dtdx\""))
+	p.CheckIndentUnit = true
+	p.Warn = func(d Diagnostic) { warnings = append(warnings, d.String()) }
+	p.Resolve = func(string) (io.Reader, error) { return strings.NewReader("e\n\tf\ng\n  h"), nil }
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	expect := "warning: Indent of 4 columns differs from the indent unit of 2 columns.|" +
+		"warning: Indent of 2 columns differs from the indent unit of 4 columns."
+	if got := strings.Join(warnings, "|"); got != expect {
+		t.Errorf("Expected warnings %q, but found %q", expect, got)
+	}
+}
+
+func TestParseTabWidth(t *testing.T) {
+	parse := func(width int) string {
+		p := NewParser(strings.NewReader("a\n\tb\n        c\n#INCLUDE \"d.dtdx\""))
+		p.TabWidth = width
+		p.Resolve = func(string) (io.Reader, error) { return strings.NewReader("d\n\te\n        f"), nil }
+		root, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names(&root.Content) + " " + names(&p.elements["d"].Content)
+	}
+	if got, expect := parse(8), "(b, c) (e, f)"; got != expect {
+		t.Errorf("Expected a tab to reach column 9 with TabWidth 8: %s, but found %s", expect, got)
+	}
+	if got, expect := parse(0), "(b) (e)"; got != expect {
+		t.Errorf("Expected a tab to reach column 5 by default: %s, but found %s", expect, got)
+	}
+}
+
+func TestParseDocuments(t *testing.T) {
+	// The example documents are sketches, kept as they were written, and
+	// some break rules of the grammar.  These are the errors they have.
+	known := map[string][]string{
+		"Runtime.DTDX": { // indented as a whole, as if pasted from a larger file
+			`line 4, col 1: found "        ", expected element identifier`,
+		},
+		"screenplay.DTDX": {
+			"line 42, col 13: element Title is defined more than once",
+			"line 82, col 42: element Steps is defined more than once",
+			"line 84, col 57: element Notice is defined at the top level and cannot have the modifier +",
+			"line 91, col 5: element Supplies is defined more than once",
+			"line 98, col 11: element Steps is defined more than once",
+		},
+	}
+	files, err := filepath.Glob("../../documents/*.DTDX")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Expected the example documents, but found %v (%v)", files, err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			p, err := NewFileParser(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Lenient = true // #URI is not a DTD type
+			root, errs := p.ParseAll()
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			if expect := known[filepath.Base(file)]; strings.Join(got, "\n") != strings.Join(expect, "\n") {
+				t.Errorf("Expected the errors\n%s\nbut found\n%s", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+			}
+			if root == nil {
+				return
+			}
+			if err := WriteDTD(io.Discard, root); err != nil {
+				t.Errorf("Expected a DTD, but found %v", err)
+			}
+		})
+	}
+}
+
+func TestParseQualifiedNames(t *testing.T) {
+	root, err := NewParser(strings.NewReader("html:body xml:lang=\n  p")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Name != "html:body" || root.Prefix() != "html" || root.Local() != "body" {
+		t.Errorf("Expected html:body to have prefix html and local body, but found %q %q", root.Prefix(), root.Local())
+	}
+	if a := root.Attrs[0]; a.Prefix() != "xml" || a.Local() != "lang" {
+		t.Errorf("Expected xml:lang to have prefix xml and local lang, but found %q %q", a.Prefix(), a.Local())
+	}
+	if p := root.Content.children[0].element; p.Prefix() != "" || p.Local() != "p" {
+		t.Errorf("Expected p to have no prefix, but found %q %q", p.Prefix(), p.Local())
+	}
+}
+
+func TestParseEnumeration(t *testing.T) {
+	root, err := NewParser(strings.NewReader("paragraph justify=( left | right|center ) name=")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDefPos(root)
+	expect := Attribute{Name: "justify", Type: "(left|right|center)", Occur: implied}
+	if len(root.Attrs) != 2 || root.Attrs[0] != expect {
+		t.Errorf("Expected %v, but found %v", expect, root.Attrs)
+	}
+
+	root, err = NewParser(strings.NewReader(`p size=(1|2|3) "1" rev=( 1.0 | -2 | .5 )`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := root.Attrs[0].Type + " " + root.Attrs[1].Type; got != "(1|2|3) (1.0|-2|.5)" {
+		t.Errorf("Expected NMTOKEN values that start with a digit, '-' or '.', but found %s", got)
+	}
+	if _, err := NewParser(strings.NewReader("p size=1")).Parse(); err == nil {
+		t.Errorf("Expected a digit outside an enumeration to be an error")
+	}
+}
+
+func TestParseNotation(t *testing.T) {
+	root, err := NewParser(strings.NewReader("img format=NOTATION( gif | jpeg ) #REQUIRED NOTATION=")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDefPos(root)
+	expect := Attribute{Name: "format", Type: "NOTATION (gif|jpeg)", Occur: required}
+	if len(root.Attrs) != 2 || root.Attrs[0] != expect {
+		t.Fatalf("Expected %v, but found %v", expect, root.Attrs)
+	}
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "format   NOTATION (gif|jpeg) #REQUIRED") {
+		t.Errorf("Expected a NOTATION attribute, but found:\n%s", got)
+	}
+	if _, err := NewParser(strings.NewReader("img format=NOTATION(gif|gif)")).Parse(); err == nil {
+		t.Errorf("Expected a repeated notation to be an error")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	root, err := NewParser(strings.NewReader("a ref=#IDREF->widget refs=#IDREFS->widget #REQUIRED")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDefPos(root)
+	expect := []Attribute{
+		{Name: "ref", Type: "IDREF", Occur: implied, Target: "widget"},
+		{Name: "refs", Type: "IDREFS", Occur: required, Target: "widget"},
+	}
+	if len(root.Attrs) != 2 || root.Attrs[0] != expect[0] || root.Attrs[1] != expect[1] {
+		t.Fatalf("Expected %v, but found %v", expect, root.Attrs)
+	}
+	var buf bytes.Buffer
+	if err := WriteDTD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	want := "<!ELEMENT a (#PCDATA)>\n" +
+		"<!-- ref -> widget -->\n" +
+		"<!-- refs -> widget -->\n" +
+		"<!ATTLIST a\n" +
+		"    ref  IDREF  #IMPLIED\n" +
+		"    refs IDREFS #REQUIRED\n" +
+		"    >\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", want, got)
+	}
+
+	for src, msg := range map[string]string{
+		"a ref=#CDATA->widget": "line 1, col 15: element a: attribute ref: only an IDREF or IDREFS attribute has a target",
+		"a ref=#IDREF->":       "line 1, col 15: found end of input, expected element name after ->",
+	} {
+		if _, err := NewParser(strings.NewReader(src)).Parse(); err == nil || err.Error() != msg {
+			t.Errorf("%q: expected %q, but found %v", src, msg, err)
+		}
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	src := `a w= x=#REQUIRED y="yes" z=#FIXED 'no' v=(on|off) #IMPLIED u=#NMTOKEN "up"`
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDefPos(root)
+	expect := []Attribute{
+		{Name: "w", Type: "CDATA", Occur: implied, TypeInferred: true},
+		{Name: "x", Type: "CDATA", Occur: required, TypeInferred: true},
+		{Name: "y", Type: "CDATA", Default: "yes", TypeInferred: true},
+		{Name: "z", Type: "CDATA", Occur: fixed, Default: "no", TypeInferred: true},
+		{Name: "v", Type: "(on|off)", Occur: implied},
+		{Name: "u", Type: "NMTOKEN", Default: "up"},
+	}
+	if len(root.Attrs) != len(expect) {
+		t.Fatalf("Expected %v, but found %v", expect, root.Attrs)
+	}
+	for i, a := range expect {
+		if root.Attrs[i] != a {
+			t.Errorf("Expected %v, but found %v", a, root.Attrs[i])
+		}
+	}
+}
+
+func TestParseImplied(t *testing.T) {
+	root, err := NewParser(strings.NewReader("a name=#IMPLIED id=#ID")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearDefPos(root)
+	expect := []Attribute{
+		{Name: "name", Type: "CDATA", Occur: implied, TypeInferred: true},
+		{Name: "id", Type: "ID", Occur: implied},
+	}
+	if len(root.Attrs) != len(expect) || root.Attrs[0] != expect[0] || root.Attrs[1] != expect[1] {
+		t.Errorf("Expected %v, but found %v", expect, root.Attrs)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect string
+	}{
+		{"", "document has no element definition"},
+		{"a\n  b\n  b", "line 3, col 3: element b is defined more than once"},
+		{"a\n  (b c)", `line 2, col 6: found "c", expected separator or ')'`},
+		{"a\n  (b, c | d)", `line 2, col 9: found "|" in a group separated by ","`},
+		{"a\n  (b | c, d)", `line 2, col 9: found "," in a group separated by "|"`},
+		{"a => b | c & d", `line 1, col 12: found "&" in a group separated by "|"`},
+		{"a\n  (b,,c)", `line 2, col 6: found "," right after another separator`},
+		{"a\n  (,b)", `line 2, col 4: found "," before the first particle of a group`},
+		{"a\n  (b,)", `line 2, col 5: found "," after the last particle of a group`},
+		{"a => b,,c", `line 1, col 8: found "," right after another separator`},
+		{"a?\n  b", "line 1, col 2: element a is defined at the top level and cannot have the modifier ?"},
+		{"a\nb id= *", "line 2, col 7: element b is defined at the top level and cannot have the modifier *"},
+		{"a => ,b", `line 1, col 6: found "," before the first particle of a group`},
+		{"a => b,\nc", `line 1, col 7: found "," after the last particle of a group`},
+		{"a\n  ()", `line 2, col 4: found ")", expected element, reference or group`},
+		{"a\n  (b", "line 2, col 5: found dedent, expected separator or ')'"},
+		{"a\n  b...\n    c", "line 3, col 1: found indent, expected element, reference or group"},
+		{"a x=#ID y=#ID", "line 1, col 11: element a: attribute y: second ID attribute after x"},
+		{"?", `line 1, col 1: found "?", expected element identifier`},
+		{"a x=()", `line 1, col 6: found ")", expected enumeration value`},
+		{"a x=(b, c)", `line 1, col 7: found ",", expected '|' or ')'`},
+		{"a x=(b & c)", `line 1, col 8: found "&", expected '|' or ')'`},
+		{"a x=#FIXED", "line 1, col 11: found end of input, expected quoted value after #FIXED"},
+		{"a x=#FIXED y=", `line 1, col 12: found "y", expected quoted value after #FIXED`},
+		{"a x=(b|b)", `line 1, col 9: element a: attribute x: duplicate enumeration value "b"`},
+		{`a x=#IMPLIED "y"`, "line 1, col 15: element a: attribute x: #IMPLIED attribute cannot have a default"},
+		{"a #EMPTY\n  b", "line 2, col 1: element a has both EMPTY content and indented children"},
+		{"a => b\n  c", "line 2, col 1: element a has both inline content and indented children"},
+		{"a => b, c | d", `line 1, col 11: found "|" in a group separated by ","`},
+		{"a\n  (b => c)", `line 2, col 6: found "=>", expected separator or ')'`},
+		{"a =>", "line 1, col 5: found end of input, expected element, reference or group"},
+		{"a\n  \"open", "line 2, col 4: Unexpected end of input inside quoted value: open"},
+		{"a:b:c", "line 1, col 1: name a:b:c has more than one colon"},
+		{"a\n  b:c:d...", "line 2, col 3: name b:c:d has more than one colon"},
+		{"a x:y:z=", "line 1, col 3: name x:y:z has more than one colon"},
+		{"%x = b\n%x = c\na", "line 2, col 1: parameter entity %x is defined more than once"},
+		{"%x b\na", `line 1, col 4: found "b", expected '=' after %x`},
+		{"a\n  b\n  %x", "line 3, col 3: parameter entity %x is referenced but never defined"},
+		{"a => %x\n%x = (b | %y)\n%y = %x*", "line 2, col 1: parameter entity %x refers to itself"},
+		{"a\n  b? id= *", "line 2, col 10: element b has a modifier after its name and another after its attributes"},
+		{"a *", "line 1, col 3: element a is defined at the top level and cannot have the modifier *"},
+		{"a\n  b\n  id=#ID", "line 3, col 3: attribute id of a follows its content; attributes go on the definition line"},
+		{"a => (b, id=#ID)", "line 1, col 10: attribute id of a follows its content; attributes go on the definition line"},
+		{"a\n  b\n)\n", `line 3, col 1: unexpected trailing content ")"`},
+		{"a\n=> b", `line 2, col 1: unexpected trailing content "=>"`},
+		{"a\nb\n*", `line 3, col 1: unexpected trailing content "*"`},
+		{")", `line 1, col 1: found ")", expected element identifier`},
+		{"a b= c", `line 1, col 6: found "c", expected end of line`},
+		{"a\nb c", `line 2, col 3: found "c", expected end of line`},
+		{"a => b c", `line 1, col 8: found "c", expected end of line`},
+		{"%x = b c\na", `line 1, col 8: found "c", expected end of line`},
+		{"a\n  b c= d", `line 2, col 8: found "d", expected separator or end of line`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			_, err := NewParser(strings.NewReader(tC.src)).Parse()
+			if err == nil || err.Error() != tC.expect {
+				t.Errorf("Expected error %q, but found %v", tC.expect, err)
+			}
+		})
+	}
+}
+
+func TestParsePartial(t *testing.T) {
+	src := "doc\n" +
+		"  title\n" +
+		"note \"runaway\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if expect := "line 3, col 7: Runaway quote: runaway"; err == nil || err.Error() != expect {
+		t.Errorf("Expected error %q, but found %v", expect, err)
+	}
+	if root == nil || root.Name != "doc" {
+		t.Fatalf("Expected the root doc with the error, but found %v", root)
+	}
+	if got := names(&root.Content); got != "(title)" {
+		t.Errorf("Expected doc to have title, but found %s", got)
+	}
+	if root, err := NewParser(strings.NewReader("\"runaway\n")).Parse(); root != nil || err == nil {
+		t.Errorf("Expected a nil root and an error, but found %v and %v", root, err)
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	src := "doc title=\"open\n" +
+		"  head\n" +
+		"  body => (a | b, c)\n" +
+		"list\n" +
+		"  item @\n" +
+		"  more\n" +
+		"list\n" +
+		"para => (PCDATA | %inline)*\n" +
+		"  extra\n" +
+		"%inline = 'x\n" +
+		"last\n"
+	expect := []string{
+		"line 1, col 12: Runaway quote: open",
+		"line 5, col 8: Unexpected unicode character (U+0040 '@') in outer context.",
+		"line 7, col 1: element list is defined more than once",
+		"line 9, col 1: element para has both inline content and indented children",
+		"line 10, col 12: Runaway quote: x",
+	}
+	for run := 0; run < 2; run++ { // the same input gives the same errors
+		root, errs := NewParser(strings.NewReader(src)).ParseAll()
+		if len(errs) != len(expect) {
+			t.Fatalf("Expected %q, but found %v", expect, errs)
+		}
+		for i, msg := range expect {
+			if errs[i].Error() != msg {
+				t.Errorf("Expected %q, but found %q", msg, errs[i])
+			}
+		}
+		if root == nil || root.Name != "doc" {
+			t.Fatalf("Expected the best-effort root doc, but found %v", root)
+		}
+		var defs []string
+		for _, d := range root.defs {
+			defs = append(defs, d.Name)
+		}
+		if got := strings.Join(defs, " "); got != "doc list item para last" {
+			t.Errorf("Expected definitions doc list item para last, but found %s", got)
+		}
+	}
+
+	_, err := NewParser(strings.NewReader(src)).Parse()
+	if err == nil || err.Error() != expect[0] {
+		t.Errorf("Expected Parse to stop at %q, but found %v", expect[0], err)
+	}
+	if root, errs := NewParser(strings.NewReader("@\n")).ParseAll(); root != nil || len(errs) != 1 {
+		t.Errorf("Expected a nil root and one error, but found %v and %v", root, errs)
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	src := "# stray\n" +
+		"\n" +
+		"# the document\n" +
+		"# of paragraphs\n" +
+		"doc id= # trailing\n" +
+		"  title => b, c # on title only\n" +
+		"\n" +
+		"  # detached\n" +
+		"\n" +
+		"  para... # on a reference line\n" +
+		"  # before note\n" +
+		"  note\n"
+	p := NewParser(strings.NewReader(src))
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{
+		"doc":   "the document|of paragraphs|trailing",
+		"title": "on title only",
+		"b":     "",
+		"note":  "before note",
+	}
+	for name, want := range expect {
+		if got := strings.Join(p.elements[name].Doc, "|"); got != want {
+			t.Errorf("Expected %s to have comments %q, but found %q", name, want, got)
+		}
+	}
+}
+
+func TestParseCommentIndent(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect string
+	}{
+		{"a\n\tb\n\t\t# deeper comment\n\tc", "(b, c)"},
+		{"a\n\tb\n# shallower comment\n\tc", "(b, c)"},
+		{"a\n\tb\n\t\t\t# deeper comment\n\t\tc\n\td", "(b, d)"},
+		{"a\n\tb\n\t\t# trailing deeper comment", "(b)"},
+		{test1, "(title?, line+)"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			root, err := NewParser(strings.NewReader(tC.src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(&root.Content); got != tC.expect {
+				t.Errorf("Expected %s, but found %s", tC.expect, got)
+			}
+		})
+	}
+}
+
+// clearDefPos zeroes the positions of the attributes of e, so that they
+// compare by what was parsed.
+func clearDefPos(e *Element) {
+	for i := range e.Attrs {
+		e.Attrs[i].DefPos = Position{}
+	}
+}
+
+func TestParseDefPos(t *testing.T) {
+	p := NewParser(strings.NewReader(test1))
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// paragraph runs from its name to the end of line...+ on line 5.
+	if got, expect := root.DefPos, (Position{Line: 2, Col: 1, EndLine: 5, EndCol: 13}); got != expect {
+		t.Errorf("paragraph: expected %v, but found %v", expect, got)
+	}
+	title := root.Content.children[0].element
+	if got, expect := title.DefPos, (Position{Line: 4, Col: 5, EndLine: 4, EndCol: 11}); got != expect {
+		t.Errorf("title: expected %v, but found %v", expect, got)
+	}
+
+	p = NewParser(strings.NewReader("a\n  b id=#ID x=\"1\" => c, d\n"))
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	b := p.elements["b"]
+	if got, expect := b.DefPos, (Position{Line: 2, Col: 3, EndLine: 2, EndCol: 25}); got != expect {
+		t.Errorf("b: expected %v, but found %v", expect, got)
+	}
+	if got, expect := b.Attrs[1].DefPos, (Position{Line: 2, Col: 12, EndLine: 2, EndCol: 17}); got != expect {
+		t.Errorf("x: expected %v, but found %v", expect, got)
+	}
+}
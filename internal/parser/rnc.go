@@ -0,0 +1,266 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteRNC writes a RELAX NG schema in the compact syntax.  The start pattern
+// is root, and root and every element it reaches become a named pattern,
+// each once, that the content models refer to by name, so recursive content
+// needs no expansion.  Sequences, choices and & groups become ',', '|' and
+// '&' patterns with their multiplicity as the occurrence operator, #PCDATA
+// becomes text, and ANY content a repeated choice of text and every element.
+// Parameter entities are replaced by their content.
+//
+// Attributes are optional unless #REQUIRED, with the type as an XML Schema
+// datatype, or text for CDATA.  An enumeration becomes a choice of its
+// values, and a #FIXED attribute its one value.  A default value is written
+// as an a:defaultValue annotation from the RELAX NG DTD compatibility
+// namespace.  The comments on a definition come right before its pattern.
+//
+// Each prefix of a name is declared as a namespace, with the value of the
+// xmlns attribute that declares it, as in xmlns:html #FIXED "...", or else
+// as inherit, which leaves the names in the namespace of the document.  The
+// xmlns attributes themselves are namespace declarations, not attributes,
+// and are left out.
+func WriteRNC(w io.Writer, root *Element) error {
+	bw := bufio.NewWriter(w)
+	s := newRNCSchema(reachable(root))
+	annotated := false
+	namespaces := map[string]string{}
+	var prefixes []string
+	declare := func(prefix string) {
+		if _, ok := namespaces[prefix]; !ok && prefix != "" && prefix != "xml" {
+			namespaces[prefix] = "inherit"
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	for _, e := range s.elements {
+		declare(e.Prefix())
+		for _, a := range e.Attrs {
+			annotated = annotated || a.Default != "" && a.Occur != fixed
+			if a.Prefix() != "xmlns" {
+				declare(a.Prefix())
+			}
+		}
+	}
+	for _, e := range s.elements {
+		for _, a := range e.Attrs {
+			if _, ok := namespaces[a.Local()]; ok && a.Prefix() == "xmlns" && a.Default != "" {
+				namespaces[a.Local()] = rncLiteral(a.Default)
+			}
+		}
+	}
+	for _, prefix := range prefixes {
+		bw.WriteString("namespace " + prefix + " = " + namespaces[prefix] + "\n")
+	}
+	if annotated {
+		bw.WriteString(`namespace a = "http://relaxng.org/ns/compatibility/annotations/1.0"` + "\n")
+	}
+	if annotated || len(prefixes) > 0 {
+		bw.WriteString("\n")
+	}
+	bw.WriteString("start = " + s.names[root] + "\n")
+	for _, e := range s.elements {
+		bw.WriteString("\n")
+		for _, line := range e.Doc {
+			bw.WriteString("# " + line + "\n")
+		}
+		s.writeElement(bw, e)
+	}
+	return bw.Flush()
+}
+
+// rncSchema holds the elements that a schema defines, in order, and the
+// name of the pattern of each.
+type rncSchema struct {
+	elements []*Element
+	names    map[*Element]string
+}
+
+// newRNCSchema names the pattern of each of elements.  Names that would
+// otherwise be the same, as those of html:p and html_p, are told apart by a
+// number.
+func newRNCSchema(elements []*Element) *rncSchema {
+	s := &rncSchema{elements: elements, names: map[*Element]string{}}
+	used := map[string]bool{}
+	for _, e := range elements {
+		base := strings.ReplaceAll(e.Name, ":", "_")
+		name := base
+		for i := 2; used[name]; i++ {
+			name = base + "_" + strconv.Itoa(i)
+		}
+		used[name] = true
+		s.names[e] = rncName(name)
+	}
+	return s
+}
+
+// writeElement writes the named pattern of e.  An element without
+// attributes fits on one line, and the attributes of an EMPTY element are its
+// whole pattern.
+func (s *rncSchema) writeElement(w *bufio.Writer, e *Element) {
+	w.WriteString(s.names[e] + " = element " + rncName(e.Name) + " {")
+	content := s.pattern(&e.Content)
+	var attrs []Attribute
+	for _, a := range e.Attrs {
+		if a.Name != "xmlns" && a.Prefix() != "xmlns" {
+			attrs = append(attrs, a)
+		}
+	}
+	if len(attrs) == 0 {
+		if content[0] == '(' && closes(content) {
+			content = content[1 : len(content)-1]
+		}
+		w.WriteString(" " + content + " }\n")
+		return
+	}
+	w.WriteString("\n")
+	for i, a := range attrs {
+		w.WriteString("  " + rncAttribute(a))
+		if i < len(attrs)-1 || content != "empty" {
+			w.WriteString(",")
+		}
+		w.WriteString("\n")
+	}
+	if content != "empty" {
+		w.WriteString("  " + content + "\n")
+	}
+	w.WriteString("}\n")
+}
+
+// closes reports whether the '(' that starts pattern is closed by its last
+// character, so the pattern is one parenthesized group.
+func closes(pattern string) bool {
+	depth := 0
+	for i, r := range pattern {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i == len(pattern)-1
+			}
+		}
+	}
+	return false
+}
+
+// rncSeps separates the members of the groups of a content model.
+var rncSeps = map[modelType]string{
+	groupModelType:    ", ",
+	sequenceModelType: ", ",
+	choiceModelType:   " | ",
+	allModelType:      " & ",
+}
+
+// pattern renders the content model fragment c as a pattern.  ANY content
+// chooses from all the elements of s.
+func (s *rncSchema) pattern(c *ContentModel) string {
+	m := string(c.multiplicity)
+	switch c.modelType {
+	case unknownModelType:
+		return "text"
+	case pcdataModelType:
+		return "text" + m
+	case elementModelType:
+		return s.names[c.element] + m
+	case emptyModelType:
+		return "empty"
+	case anyModelType:
+		members := []string{"text"}
+		for _, e := range s.elements {
+			members = append(members, s.names[e])
+		}
+		return "(" + strings.Join(members, " | ") + ")*"
+	case entityModelType:
+		content := s.pattern(c.children[0])
+		if m == "" {
+			return content
+		}
+		return "(" + content + ")" + m
+	}
+	members := make([]string, len(c.children))
+	for i, child := range c.children {
+		members[i] = s.pattern(child)
+	}
+	return "(" + strings.Join(members, rncSeps[c.modelType]) + ")" + m
+}
+
+// rncAttribute renders a as an attribute pattern.
+func rncAttribute(a Attribute) string {
+	var value string
+	switch {
+	case a.Occur == fixed:
+		value = rncLiteral(a.Default)
+	case isNotation(a.Type):
+		value = rncChoice(notationValues(a.Type))
+	case isEnumeration(a.Type):
+		value = rncChoice(enumValues(a.Type))
+	case a.Type == "" || a.Type == "CDATA":
+		value = "text"
+	default:
+		value = "xsd:" + strings.TrimPrefix(xsdType(a.Type), "xs:")
+	}
+	result := "attribute " + rncName(a.Name) + " { " + value + " }"
+	if a.Occur == required {
+		return result
+	}
+	if a.Default != "" && a.Occur != fixed {
+		result = "[ a:defaultValue = " + rncLiteral(a.Default) + " ] " + result
+	}
+	return result + "?"
+}
+
+// rncChoice renders values as a choice of literals.
+func rncChoice(values []string) string {
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = rncLiteral(v)
+	}
+	return strings.Join(literals, " | ")
+}
+
+// rncLiteral quotes s, with single quotes when it holds a double quote.  One
+// that holds both is a concatenation, with ~, of its double quotes in single
+// quotes and the rest in double quotes.
+func rncLiteral(s string) string {
+	switch {
+	case !strings.Contains(s, `"`):
+		return `"` + s + `"`
+	case !strings.Contains(s, "'"):
+		return "'" + s + "'"
+	}
+	var parts []string
+	for i, part := range strings.Split(s, `"`) {
+		if i > 0 {
+			parts = append(parts, `'"'`)
+		}
+		if part != "" {
+			parts = append(parts, `"`+part+`"`)
+		}
+	}
+	return strings.Join(parts, " ~ ")
+}
+
+// rncKeywords are the keywords of the compact syntax, which a name must
+// escape with a backslash.
+var rncKeywords = map[string]bool{
+	"attribute": true, "default": true, "datatypes": true, "div": true,
+	"element": true, "empty": true, "external": true, "grammar": true,
+	"include": true, "inherit": true, "list": true, "mixed": true,
+	"namespace": true, "notAllowed": true, "parent": true, "start": true,
+	"string": true, "text": true, "token": true,
+}
+
+// rncName renders the name of an element or attribute.
+func rncName(name string) string {
+	if rncKeywords[name] {
+		return `\` + name
+	}
+	return name
+}
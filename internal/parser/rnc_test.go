@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteRNC(t *testing.T) {
+	src := "# The whole document.\n" +
+		"doc id= kind=(a|b) #REQUIRED\n" +
+		"  title? lang=\"en\" version=#FIXED \"1\"\n" +
+		"  (para... | list...)+\n" +
+		"%inline = (bold | text)\n" +
+		"para => (PCDATA | %inline)*\n" +
+		"list\n" +
+		"  item*\n" +
+		"    list...?\n" +
+		"  hr ref=#IDREF #EMPTY\n" +
+		"  note #ANY\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `namespace a = "http://relaxng.org/ns/compatibility/annotations/1.0"
+
+start = doc
+
+# The whole document.
+doc = element doc {
+  attribute id { xsd:ID }?,
+  attribute kind { "a" | "b" },
+  (title?, (para | \list)+)
+}
+
+title = element title {
+  [ a:defaultValue = "en" ] attribute lang { text }?,
+  attribute version { "1" }?,
+  text
+}
+
+para = element para { (text | (bold | \text))* }
+
+bold = element bold { text }
+
+\text = element \text { text }
+
+\list = element \list { item*, hr, note }
+
+item = element item { \list? }
+
+hr = element hr {
+  attribute ref { xsd:IDREF }?
+}
+
+note = element note { (text | doc | title | para | bold | \text | \list | item | hr | note)* }
+`
+	var out bytes.Buffer
+	if err := WriteRNC(&out, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteRNCNames(t *testing.T) {
+	src := "doc xmlns:html=#FIXED \"http://www.w3.org/1999/xhtml\" xml:lang=\n" +
+		"  html:p svg:class=\n" +
+		"  html_p\n" +
+		"  start\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `namespace html = "http://www.w3.org/1999/xhtml"
+namespace svg = inherit
+
+start = doc
+
+doc = element doc {
+  attribute xml:lang { text }?,
+  (html_p, html_p_2, \start)
+}
+
+html_p = element html:p {
+  attribute svg:class { text }?,
+  text
+}
+
+html_p_2 = element html_p { text }
+
+\start = element \start { text }
+`
+	var out bytes.Buffer
+	if err := WriteRNC(&out, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestRNCLiteral(t *testing.T) {
+	testCases := []struct {
+		value, expect string
+	}{
+		{`plain`, `"plain"`},
+		{`it's`, `"it's"`},
+		{`say "hi"`, `'say "hi"'`},
+		{`it's "hi"`, `"it's " ~ '"' ~ "hi" ~ '"'`},
+		{`"'`, `'"' ~ "'"`},
+	}
+	for _, tC := range testCases {
+		if got := rncLiteral(tC.value); got != tC.expect {
+			t.Errorf("Expected %s for %s, but found %s", tC.expect, tC.value, got)
+		}
+	}
+}
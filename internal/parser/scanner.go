@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"unicode"
 
 	"github.com/adobrowolski/dtdx/internal/lexer"
@@ -27,6 +28,9 @@ const (
 	directiveTok    // #VALUE
 	commentTok      // # value
 	eofTok          // signals end of input
+	arrowTok        // =>
+	entityTok       // %name
+	targetTok       // ->
 )
 
 func init() {
@@ -43,6 +47,9 @@ func init() {
 	lexer.TokenName[directiveTok] = "directiveTok"
 	lexer.TokenName[commentTok] = "commentTok"
 	lexer.TokenName[eofTok] = "eofTok"
+	lexer.TokenName[arrowTok] = "arrowTok"
+	lexer.TokenName[entityTok] = "entityTok"
+	lexer.TokenName[targetTok] = "targetTok"
 }
 
 /* -----------------------------------------------------------------------------
@@ -50,7 +57,8 @@ func init() {
 NewLineState is the initial state. Like python indents matter. Whitespace is
 scanned up until the first non-blank token. An 'indent' or 'dedent' token will
 be emitted if the indent increases or decreases respectively. Then the state
-will change to OuterState.
+will change to OuterState.  A newline is \n, \r\n or a lone \r; the \r never
+appears in a token value or an indent.
 
 In OuterState whitespace is ignored. The state transitions to
 - NewLineState 		after a newline
@@ -58,47 +66,187 @@ In OuterState whitespace is ignored. The state transitions to
 - SingleQuoteState 	after a single quote
 - DoubleQuoteState 	after a double quote
 - IdentifierState 	after a hash or alphanumeric
-All the single character tokens will be emitted while in this state.
+- EntityState 		after a % followed by a letter
+All the single character tokens will be emitted while in this state, and so
+will '=>', which is one arrowTok rather than '=' and an unexpected '>'.
 
 SingleQuoteState and DoubleQuoteState lex the body of a quote and emit it,
 either as the sQuote or dQuote token, going back to OuterState when done.
+Within the body a backslash escapes the quote in use or another backslash;
+the emitted value holds the unescaped text.
 
 IdentifierState scans tokens that start with an alphanumeric value or a #
-immediately followed by an alphanumeric value. It can emit 'ident' and
-'reference' tokens.
+immediately followed by an alphanumeric value.  Inside the parentheses that
+follow an '=', the values of an enumeration are NMTOKENs, so there a name
+may also start with a digit, '.' or '-', as in size=(1|2|3). It can emit 'ident' and
+'reference' tokens.  A ':' may appear anywhere in a name, so a qualified name
+such as html:body is one token; the parser checks its form.  As in XML names,
+'-' and '.' may continue a name, as in my-element or config.v2, but a '.'
+followed by another '.' ends it, so line... is still a reference.
+
+EntityState scans a parameter entity name such as %inline and emits it as an
+'entity' token holding the bare name.  A ';' right after the name, as in
+DTD syntax, is optional and dropped.
 
 CommentState eats an initial # and parses the remaining characters up to
-the newline, emiting a 'comment'.  It then goes to the OuterState.
+the newline, emiting a 'comment'.  It then goes to the OuterState.  A line
+that holds only a comment emits no 'indent' or 'dedent', whatever its
+whitespace, so a comment may be indented more or less than its neighbours.
+
+A # immediately followed by an uppercase letter is a directive when it
+follows another token on the same line (after an '=', a name, or inside a
+content group). At the start of a line it is a directive only if the whole
+word is one that can start a line in its context: #INCLUDE on a line that
+is not indented, among the top level declarations, and #PCDATA on an
+indented line, in the content of a definition.  Any other #WORD there is a
+comment-like heading, so "#REQUIRED" or "#INCLUDES" alone on a line lexes
+as a commentTok.
+
+The reference suffix is "..." unless the scanner is configured with another
+one, such as "~". A configured suffix is matched before any other token, and
+then a '.' is no longer the start of a reference.
+
+A literal # can be written as \# anywhere an identifier may start or
+continue, including the start of a line. The escape is part of the
+identifier and neither starts a comment nor a directive; the emitted value
+has the backslash removed. A backslash before any other rune is an error.
+
+When the indent unit check is enabled, the width of the first indent step
+becomes the unit for the document. A later step of a different width still
+indents, but is reported with a warning since it is likely a mistake.
 
 */
 
+// scanState is the per-document state of the scanner kept in lexer.Lex.State.
+type scanState struct {
+	indents     []indent // open indent levels; the bottom level is never popped
+	lineStart   bool     // true until a token is emitted on the current line
+	indented    bool     // the current line starts with whitespace
+	indentUnit  int      // width of the first indent step, once one is seen
+	afterEquals bool     // only whitespace since an '=' on this line
+	inEnum      bool     // inside the '(' of an enumeration after an '='
+
+	lenientEllipsis bool         // accept 2+ dots as a reference, with a warning
+	refSuffix       string       // reference suffix used instead of "..." if set
+	indentPolicy    IndentPolicy // whitespace allowed in indentation
+	checkIndentUnit bool         // warn when an indent step differs from the unit
+	messages        Messages     // overrides for error messages
+	recover         bool         // go on at the next line after an error
+}
+
+// IndentPolicy restricts the whitespace characters allowed in indentation.
+type IndentPolicy int
+
+const (
+	// Either allows tabs and spaces in indentation (the default).
+	Either IndentPolicy = iota
+	// TabsOnly rejects lines indented with spaces.
+	TabsOnly
+	// SpacesOnly rejects lines indented with tabs.
+	SpacesOnly
+)
+
+// getState returns the scanner state, lazily initializing it if needed.
+func getState(l *lexer.Lex) *scanState {
+	st, ok := l.State.(*scanState)
+	if !ok {
+		st = &scanState{}
+		l.State = st
+	}
+	if len(st.indents) == 0 {
+		st.indents = []indent{{}}
+	}
+	return st
+}
+
+// indent is one level of the indent stack.  The raw whitespace is kept so that
+// a dedentTok can carry the exact whitespace of the level it returns to.
+type indent struct {
+	width int    // measured width of the whitespace
+	raw   string // whitespace as written in the source
+}
+
+// singleChars are the punctuation runes that are complete tokens by themselves.
+var singleChars = lexer.SingleChars{}.
+	Register("=", equalsTok).
+	Register("(", openTok).
+	Register(")", closeTok).
+	Register(",|&", separatorTok).
+	Register("*+?", multiplicityTok)
+
 // OuterState handles all single letter tokens and delegates to other states.
 func OuterState(l *lexer.Lex) lexer.StateFunc {
+	st := getState(l)
 	for {
-		switch r := l.Next(); r {
+		if custom := st.refSuffix; custom != "" && custom != "..." && l.LookingAt(custom) {
+			for range custom {
+				l.Next()
+			}
+			st.lineStart = false
+			l.Emit(referenceTok)
+			continue
+		}
+		r := l.Next()
+		lineStart, afterEquals := st.lineStart, st.afterEquals
+		if r != ' ' && r != '\t' {
+			st.lineStart = false // a token follows on this line
+			st.afterEquals = false
+		}
+		if r == '=' && l.Peek() == '>' {
+			l.Next()
+			l.Emit(arrowTok)
+			continue
+		}
+		if r == '-' && l.Peek() == '>' {
+			l.Next()
+			l.Emit(targetTok)
+			continue
+		}
+		if t, ok := singleChars.Lookup(r); ok {
+			switch {
+			case t == equalsTok:
+				st.afterEquals = true
+			case t == openTok && afterEquals:
+				st.inEnum = true
+			case t == closeTok:
+				st.inEnum = false
+			}
+			l.Emit(t)
+			continue
+		}
+		if st.inEnum && isNameChar(r) { // an NMTOKEN, which may start with a digit
+			return IdentifierState
+		}
+		switch r {
 		case ' ', '\t':
 			l.Ignore()
 		case '\n':
 			return NewlineState
-		case '=':
-			l.Emit(equalsTok)
-		case '(':
-			l.Emit(openTok)
-		case ')':
-			l.Emit(closeTok)
-		case ',', '|', '&':
-			l.Emit(separatorTok)
-		case '*', '+', '?':
-			l.Emit(multiplicityTok)
+		case '\r':
+			l.Accept("\n") // \r\n and a lone \r are one newline
+			return NewlineState
 		case '"':
 			return DoubleQuoteState
 		case '\'':
 			return SingleQuoteState
 		case '.':
+			if st.refSuffix != "" && st.refSuffix != "..." {
+				return scanErrorf(l, UnexpectedChar, r)
+			}
 			return ReferenceState
+		case '%':
+			if r = l.Peek(); unicode.IsLetter(r) || r == '_' || r == ':' {
+				return EntityState
+			}
+			return scanErrorf(l, UnexpectedChar, '%')
+		case '\\':
+			if l.Peek() == '#' {
+				l.Next() // the escaped # starts an identifier
+				return IdentifierState
+			}
+			return scanErrorf(l, UnexpectedChar, r)
 		case '#':
-			r = l.Peek()
-			if 'A' <= r && r <= 'Z' {
+			if isDirective(l, lineStart, st.indented) {
 				return DirectiveState
 			}
 			return CommentState
@@ -110,58 +258,100 @@ func OuterState(l *lexer.Lex) lexer.StateFunc {
 			if unicode.IsLetter(r) || r == '_' || r == ':' {
 				return IdentifierState
 			}
-			return l.Errorf("Unexpected unicode character (%#U) in outer context.", r)
+			return scanErrorf(l, UnexpectedChar, r)
 		}
 	}
 }
 
-// NewlineState handles a \n and emits an 'indent'.
+// NewlineState handles a newline, which is \n, \r\n or a lone \r, and emits an
+// 'indent'.
 func NewlineState(l *lexer.Lex) lexer.StateFunc {
 	l.Ignore() // drop the newline (if any)
+	st := getState(l)
+	st.lineStart, st.afterEquals, st.inEnum = true, false, false
 	l.AcceptRun("\t ")
-	if l.LookingAt("\n") { // empty line?
-		l.Next() // move past the newline and try again
-		return NewlineState
+	st.indented = l.Current() != ""
+	if l.LookingAt("\n") || l.LookingAt("\r") { // empty line?
+		if l.Next() == '\r' {
+			l.Accept("\n")
+		}
+		return NewlineState // move past the newline and try again
+	}
+	if l.AtEnd() { // trailing whitespace is a blank line too; never measure it
+		l.Ignore()
+		return OuterState
+	}
+	if l.LookingAt("#") { // a line of only a comment leaves the indent as it is
+		l.Next()
+		comment := !isDirective(l, true, st.indented)
+		l.Backup()
+		if comment {
+			l.Ignore()
+			return OuterState
+		}
 	}
 
+	switch ws := l.Current(); st.indentPolicy {
+	case TabsOnly:
+		if strings.ContainsRune(ws, ' ') {
+			return scanErrorf(l, DisallowedIndent, "spaces", "tabs")
+		}
+	case SpacesOnly:
+		if strings.ContainsRune(ws, '\t') {
+			return scanErrorf(l, DisallowedIndent, "tabs", "spaces")
+		}
+	}
 	return updateIndent(l)
 }
 
+// updateIndent compares the whitespace just scanned with the indent stack.
+// An indentTok carries the whitespace of the new level.  Each dedentTok
+// carries the whitespace of the level it returns to, and the last one carries
+// the whitespace of the current line, so indentation can be reconstructed.
 func updateIndent(l *lexer.Lex) lexer.StateFunc {
-	type intStack []int
-	// do lazy initialization of the lexer state if needed
-	if _, ok := l.State.(intStack); !ok {
-		l.State = intStack{0} // zero value is never popped
-	}
-
-	indents := l.State.(intStack)
-	switch size, peek := measure(l.Current()), indents[len(indents)-1]; {
+	st := getState(l)
+	indents := st.indents
+	raw := l.Current()
+	switch size, peek := measure(raw, l.TabSize()), indents[len(indents)-1].width; {
 	case size == peek:
 		l.Ignore()
 	case size > peek:
 		l.Emit(indentTok)
-		l.State = append(indents, size) // push
+		st.indents = append(indents, indent{size, raw}) // push
+		if step := size - peek; st.checkIndentUnit {
+			if st.indentUnit == 0 {
+				st.indentUnit = step
+			} else if step != st.indentUnit {
+				l.Warnf("Indent of %d columns differs from the indent unit of %d columns.", step, st.indentUnit)
+			}
+		}
 	case size < peek:
 		for size < peek {
-			l.Emit(dedentTok)
-			peek, indents = indents[len(indents)-2], indents[:len(indents)-1] // pop
+			indents = indents[:len(indents)-1] // pop
+			top := indents[len(indents)-1]
+			if peek = top.width; peek > size {
+				l.EmitValue(dedentTok, top.raw)
+			} else {
+				l.EmitValue(dedentTok, raw)
+			}
 		}
-		l.State = indents
+		st.indents = indents
 		if peek < size {
-			return l.Errorf("Inconsistent dedent. Expecting %d but found %d.", peek, size)
+			return scanErrorf(l, InconsistentDedent, peek, size)
 		}
 	}
 	return OuterState
 }
 
-func measure(s string) int {
+// measure returns the width of the indent s with tab stops every tab columns.
+func measure(s string, tab int) int {
 	width := 0
 	for _, r := range s {
 		switch r {
 		case ' ':
 			width++
 		case '\t':
-			width += 4 - (width % 4)
+			width += tab - (width % tab)
 		default:
 			panic("Bad rune found in indent")
 		}
@@ -171,28 +361,71 @@ func measure(s string) int {
 
 // DoubleQuoteState handles values of the form "..."
 func DoubleQuoteState(l *lexer.Lex) lexer.StateFunc {
-	return quoteHelper(l, "\"")
+	return quoteHelper(l, '"')
 }
 
 // SingleQuoteState handles values of the form '...'
 func SingleQuoteState(l *lexer.Lex) lexer.StateFunc {
-	return quoteHelper(l, "'")
+	return quoteHelper(l, '\'')
 }
 
-func quoteHelper(l *lexer.Lex, quote string) lexer.StateFunc {
+// quoteHelper scans a quoted value up to the closing quote and emits it with
+// the escapes \" or \' (for the quote in use) and \\ replaced by the rune they
+// escape.  A backslash before any other rune is kept as it is.
+func quoteHelper(l *lexer.Lex, quote rune) lexer.StateFunc {
 	l.Ignore() // drop the initial quote
-	l.AcceptTo(quote)
-	if l.LookingAt(quote) {
-		l.Emit(quoteTok)
-		l.Next() // skip the final quote
-		return OuterState
+	var value strings.Builder
+	for {
+		switch r := l.Next(); r {
+		case quote:
+			l.EmitValue(quoteTok, value.String()) // skips the final quote too
+			return OuterState
+		case '\\':
+			if next := l.Peek(); next == quote || next == '\\' {
+				r = l.Next()
+			}
+			value.WriteRune(r)
+		case '\n', '\r':
+			l.Backup()
+			return scanErrorf(l, RunawayQuote, l.Current())
+		case lexer.EOFRune:
+			return scanErrorf(l, QuoteEOF, l.Current())
+		default:
+			value.WriteRune(r)
+		}
 	}
-
-	return l.Errorf("Runaway quote: %s", l.Current())
 }
 
 const uppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
+// lineDirectives are the directives that may start a line, by whether the
+// line is indented: #INCLUDE among the top level declarations and #PCDATA in
+// the content of a definition.
+var lineDirectives = map[bool]string{false: "INCLUDE", true: "PCDATA"}
+
+// isDirective reports whether the # just read starts a directive rather than
+// a comment.  lineStart tells whether it is the first token on its line, and
+// indented whether that line is indented.  At the start of a line only the
+// whole word of the directive for its context makes a directive.
+func isDirective(l *lexer.Lex, lineStart, indented bool) bool {
+	if r := l.Peek(); r < 'A' || r > 'Z' {
+		return false
+	}
+	if !lineStart {
+		return true
+	}
+	word := ""
+	r := l.Next()
+	for ; 'A' <= r && r <= 'Z'; r = l.Next() {
+		word += string(r)
+	}
+	whole := !isAlphaNumeric(r) && r != '-' && r != '.'
+	for range word + "#" { // back to the rune after the #
+		l.Backup()
+	}
+	return whole && word == lineDirectives[indented]
+}
+
 // DirectiveState handles #UPPERCASE directives
 func DirectiveState(l *lexer.Lex) lexer.StateFunc {
 	l.AcceptRun(uppercase)
@@ -207,31 +440,68 @@ func CommentState(l *lexer.Lex) lexer.StateFunc {
 	return OuterState
 }
 
-// IdentifierState handles identifiers (NMTOKEN)
+// IdentifierState handles identifiers (NMTOKEN) and \# escapes within them.
+// After the first rune a '-' continues the name, and so does a '.' right
+// before another name rune, which leaves the dots of name... to ReferenceState.
 func IdentifierState(l *lexer.Lex) lexer.StateFunc {
+	suffix := getState(l).refSuffix
 	for {
+		if suffix != "" && l.LookingAt(suffix) {
+			break
+		}
 		r := l.Next()
+		if r == '\\' && l.Peek() == '#' {
+			l.Next()
+			continue
+		}
+		if r == '-' || r == '.' && isAlphaNumeric(l.Peek()) {
+			continue
+		}
 		if !isAlphaNumeric(r) {
 			l.Backup()
 			break
 		}
 	}
-	l.Emit(identifierTok)
+	l.EmitValue(identifierTok, strings.ReplaceAll(l.Current(), `\#`, "#"))
+	return OuterState
+}
+
+// EntityState handles a parameter entity name after its '%'.  The name is
+// emitted without the '%', and a ';' after it, as in DTD syntax, is dropped.
+func EntityState(l *lexer.Lex) lexer.StateFunc {
+	for isAlphaNumeric(l.Next()) {
+	}
+	l.Backup()
+	l.EmitValue(entityTok, l.Current()[1:])
+	if l.Peek() == ';' {
+		l.Next()
+		l.Ignore()
+	}
 	return OuterState
 }
 
 func isAlphaNumeric(r rune) bool {
-	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	return r == '_' || r == ':' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
-// ReferenceState handles a reference ellipsis (...)
+// ReferenceState handles a reference ellipsis (...).  In lenient mode any run
+// of two or more dots is accepted, followed by a warning.
 func ReferenceState(l *lexer.Lex) lexer.StateFunc {
 	// l.Backup()
 	l.AcceptRun(".")
-	if l.Current() == "..." {
+	dots := l.Current()
+	if dots == "..." {
 		l.Emit(referenceTok)
 		return OuterState
 	}
+	if getState(l).lenientEllipsis && len(dots) >= 2 {
+		l.Emit(referenceTok)
+		l.Warnf("Reference ellipsis %q should be exactly three dots.", dots)
+		return OuterState
+	}
 
-	return l.Errorf("Malformed reference ellipsis: %s", l.Current())
+	if l.AtEnd() {
+		return scanErrorf(l, ReferenceEOF, dots)
+	}
+	return scanErrorf(l, MalformedEllipsis, dots)
 }
@@ -1,17 +1,20 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/adobrowolski/dtdx/internal/lexer"
 )
 
-func ExampleTokenTypeString() {
+func Example_tokenTypeString() {
 	for key := range lexer.TokenName {
 		fmt.Printf("Key: %2d Value: %s\n", key, key)
 	}
 	// Unordered output:
+	// Key: -2 Value: WarningTok
 	// Key: -1 Value: ErrorTok
 	// Key:  1 Value: indentTok
 	// Key:  2 Value: dedentTok
@@ -26,6 +29,11 @@ func ExampleTokenTypeString() {
 	// Key: 11 Value: directiveTok
 	// Key: 12 Value: commentTok
 	// Key: 13 Value: eofTok
+	// Key: 14 Value: arrowTok
+	// Key: 15 Value: entityTok
+	// Key: 16 Value: targetTok
+	// Key: 17 Value: declTok
+	// Key: 18 Value: declEndTok
 }
 
 const test1 = `# The first top level definition.
@@ -39,7 +47,7 @@ line
 	(PCDATA, bold)*
 		# test double dedent`
 
-func ExampleTest1() {
+func Example_test1() {
 	l := lexer.New(test1, NewlineState).Start()
 	for tok := l.NextToken(); tok != nil; tok = l.NextToken() {
 		fmt.Printf("%s\n", tok)
@@ -47,15 +55,15 @@ func ExampleTest1() {
 	// Output:
 	// {commentTok, "# The first top level definition."}
 	// {identifierTok, "paragraph"}
-	// {indentTok, "    "}
 	// {commentTok, "# A definition with two references nested inside paragraph."}
+	// {indentTok, "    "}
 	// {identifierTok, "title"}
 	// {multiplicityTok, "?"}
 	// {identifierTok, "line"}
 	// {referenceTok, "..."}
 	// {multiplicityTok, "+"}
-	// {dedentTok, ""}
 	// {commentTok, "# A second top level definition."}
+	// {dedentTok, ""}
 	// {identifierTok, "line"}
 	// {indentTok, "	"}
 	// {openTok, "("}
@@ -64,18 +72,87 @@ func ExampleTest1() {
 	// {identifierTok, "bold"}
 	// {closeTok, ")"}
 	// {multiplicityTok, "*"}
-	// {indentTok, "		"}
 	// {commentTok, "# test double dedent"}
 	// {dedentTok, ""}
-	// {dedentTok, ""}
 	// {eofTok, ""}
 }
 
+func TestEncodeTokens(t *testing.T) {
+	l := lexer.New(test1, NewlineState).Start()
+	var toks []lexer.Token
+	for tok := l.NextToken(); tok != nil; tok = l.NextToken() {
+		toks = append(toks, *tok)
+	}
+
+	var buf bytes.Buffer
+	if err := lexer.EncodeTokens(&buf, toks); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	got, err := lexer.DecodeTokens(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(toks) {
+		t.Fatalf("Expected %d tokens, but decoded %d", len(toks), len(got))
+	}
+	for i := range toks {
+		if got[i] != toks[i] {
+			t.Errorf("Token %d: expected [%v], but decoded [%v]", i, toks[i], got[i])
+		}
+	}
+
+	if _, err := lexer.DecodeTokens(bytes.NewReader(encoded[:len(encoded)-3])); err == nil {
+		t.Errorf("Expected an error decoding a truncated stream")
+	}
+}
+
+func TestDecodeTokensCorruptLength(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		stream []byte
+		expect string
+	}{
+		// type 1, line 1, col 1, ending at line 1, col 2, then a length far
+		// beyond the input
+		{"huge", []byte{2, 1, 1, 1, 2, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 'a'},
+			"token 0: bad value: unexpected EOF"},
+		{"out of range", []byte{2, 1, 1, 1, 2, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+			"token 0: bad length: 18446744073709551615 is out of range"},
+		{"short", []byte{2, 1, 1, 1, 2, 5, 'a', 'b'}, "token 0: bad value: unexpected EOF"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if _, err := lexer.DecodeTokens(bytes.NewReader(tC.stream)); err == nil || err.Error() != tC.expect {
+				t.Errorf("Expected error %q, but found %v", tC.expect, err)
+			}
+		})
+	}
+}
+
+func TestReconstructIndent(t *testing.T) {
+	const src = "a\n\tb\n\t  c\n\td\n\t  e\nf\n    g"
+	l := lexer.New(src, NewlineState).Start()
+	var lines []string
+	indent := ""
+	for tok := l.NextToken(); tok != nil; tok = l.NextToken() {
+		switch tok.Type {
+		case indentTok, dedentTok:
+			indent = tok.Value
+		case identifierTok:
+			lines = append(lines, indent+tok.Value)
+		}
+	}
+	if got := strings.Join(lines, "\n"); got != src {
+		t.Errorf("Expected %q, but reconstructed %q", src, got)
+	}
+}
+
 const test2 = `
 # Define paragraph element with three attributes
 paragraph id=#ID name= justify=(left|right|center)`
 
-func ExampleTest2() {
+func Example_test2() {
 	l := lexer.New(test2, NewlineState).Start()
 	for tok := l.NextToken(); tok != nil; tok = l.NextToken() {
 		fmt.Println(tok)
@@ -100,7 +177,26 @@ func ExampleTest2() {
 	// {eofTok, ""}
 }
 
-func ExampleAttrScanner() {
+func TestOnEmit(t *testing.T) {
+	var seen []lexer.Token
+	l := lexer.New(test2, NewlineState)
+	l.OnEmit = func(tok lexer.Token) { seen = append(seen, tok) }
+	l.Start()
+	var got []lexer.Token
+	for tok := l.NextToken(); tok != nil; tok = l.NextToken() {
+		got = append(got, *tok)
+	}
+	if len(seen) != len(got) {
+		t.Fatalf("Hook saw %d tokens, but NextToken returned %d", len(seen), len(got))
+	}
+	for i := range got {
+		if seen[i] != got[i] {
+			t.Errorf("Token %d: hook saw [%v], but NextToken returned [%v]", i, seen[i], got[i])
+		}
+	}
+}
+
+func Example_attrScanner() {
 	l := lexer.New("attr1=\"one\" attr2='2' attr3=", OuterState).Start()
 	for tok := l.NextToken(); tok != nil; tok = l.NextToken() {
 		fmt.Println(tok)
@@ -119,30 +215,62 @@ func ExampleAttrScanner() {
 
 func TestReference(t *testing.T) {
 	l := lexer.New("...", OuterState).Start()
-	got := *l.NextToken()
-	expect := lexer.Token{referenceTok, "..."}
+	got := plain(*l.NextToken())
+	expect := lexer.Token{Type: referenceTok, Value: "..."}
 	if got != expect {
 		t.Errorf("Expected '%v', got '%v'\n", expect, got)
 		t.Fail()
 	}
 }
 
+func TestLenientEllipsis(t *testing.T) {
+	for _, dots := range []string{"..", "...."} {
+		l := lexer.New("line"+dots+"+", OuterState)
+		l.State = &scanState{lenientEllipsis: true}
+		l.Start()
+		testCases := []lexer.Token{
+			{Type: identifierTok, Value: "line"},
+			{Type: referenceTok, Value: dots},
+			{Type: lexer.WarningTok, Value: "Reference ellipsis \"" + dots + "\" should be exactly three dots."},
+			{Type: multiplicityTok, Value: "+"},
+			{Type: eofTok, Value: ""},
+		}
+		for _, tC := range testCases {
+			t.Run(dots+tC.Value, func(t *testing.T) {
+				if got, expect := plain(*l.NextToken()), tC; got != expect {
+					t.Errorf("Expected [%v], but found [%v]", expect, got)
+				}
+			})
+		}
+	}
+}
+
+func TestStrictEllipsis(t *testing.T) {
+	l := lexer.New("line.. ", OuterState).Start()
+	l.NextToken()
+	got := plain(*l.NextToken())
+	expect := lexer.Token{Type: lexer.ErrorTok, Value: "Malformed reference ellipsis: .."}
+	if got != expect {
+		t.Errorf("Expected '%v', got '%v'\n", expect, got)
+	}
+}
+
 func TestNextToken3(t *testing.T) {
 	l := lexer.New("attr1=\"one\" attr2='2' attr3=", OuterState).Start()
 	testCases := []lexer.Token{
-		{identifierTok, "attr1"},
-		{equalsTok, "="},
-		{quoteTok, "one"},
-		{identifierTok, "attr2"},
-		{equalsTok, "="},
-		{quoteTok, "2"},
-		{identifierTok, "attr3"},
-		{equalsTok, "="},
-		{eofTok, ""},
+		{Type: identifierTok, Value: "attr1"},
+		{Type: equalsTok, Value: "="},
+		{Type: quoteTok, Value: "one"},
+		{Type: identifierTok, Value: "attr2"},
+		{Type: equalsTok, Value: "="},
+		{Type: quoteTok, Value: "2"},
+		{Type: identifierTok, Value: "attr3"},
+		{Type: equalsTok, Value: "="},
+		{Type: eofTok, Value: ""},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.Value, func(t *testing.T) {
-			if got, expect := *l.NextToken(), tC; got != expect {
+			if got, expect := plain(*l.NextToken()), tC; got != expect {
 				t.Errorf("Expected [%v], but found [%v]", expect, got)
 			}
 		})
@@ -152,15 +280,481 @@ func TestNextToken3(t *testing.T) {
 func TestRunawayQuote(t *testing.T) {
 	l := lexer.New("attr1=\"one attr2='2' attr3=", OuterState).Start()
 	testCases := []lexer.Token{
-		{identifierTok, "attr1"},
-		{equalsTok, "="},
-		{lexer.ErrorTok, "Runaway quote: one attr2='2' attr3="},
+		{Type: identifierTok, Value: "attr1"},
+		{Type: equalsTok, Value: "="},
+		{Type: lexer.ErrorTok, Value: "Unexpected end of input inside quoted value: one attr2='2' attr3="},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.Value, func(t *testing.T) {
+			if got, expect := plain(*l.NextToken()), tC; got != expect {
+				t.Errorf("Expected [%v], but found [%v]", expect, got)
+			}
+		})
+	}
+}
+
+func TestLineLeadingDirective(t *testing.T) {
+	l := lexer.New("#REQUIRED heading\nname=#REQUIRED\n  #FIXED", NewlineState).Start()
+	testCases := []lexer.Token{
+		{Type: commentTok, Value: "#REQUIRED heading"},
+		{Type: identifierTok, Value: "name"},
+		{Type: equalsTok, Value: "="},
+		{Type: directiveTok, Value: "#REQUIRED"},
+		{Type: commentTok, Value: "#FIXED"},
+		{Type: eofTok, Value: ""},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.Value, func(t *testing.T) {
+			if got, expect := plain(*l.NextToken()), tC; got != expect {
+				t.Errorf("Expected [%v], but found [%v]", expect, got)
+			}
+		})
+	}
+}
+
+func TestLineLeadingDirectiveContext(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect lexer.Token
+	}{
+		{"#INCLUDE \"a\"", lexer.Token{Type: directiveTok, Value: "#INCLUDE"}},
+		{"#INCLUDES follow", lexer.Token{Type: commentTok, Value: "#INCLUDES follow"}},
+		{"#INCLUDED files", lexer.Token{Type: commentTok, Value: "#INCLUDED files"}},
+		{"# INCLUDE", lexer.Token{Type: commentTok, Value: "# INCLUDE"}},
+		{"#PCDATA", lexer.Token{Type: commentTok, Value: "#PCDATA"}},
+		{"\t#PCDATA", lexer.Token{Type: directiveTok, Value: "#PCDATA"}},
+		{"\t#PCDATA2", lexer.Token{Type: commentTok, Value: "#PCDATA2"}},
+		{"\t#INCLUDE \"a\"", lexer.Token{Type: commentTok, Value: "#INCLUDE \"a\""}},
+		{"\t#REQUIRED", lexer.Token{Type: commentTok, Value: "#REQUIRED"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			l := lexer.New(tC.src, NewlineState)
+			tok := l.NextTokenSync()
+			for tok.Type == indentTok {
+				tok = l.NextTokenSync()
+			}
+			if got := plain(*tok); got != tC.expect {
+				t.Errorf("Expected [%v], but found [%v]", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestEscapedHash(t *testing.T) {
+	l := lexer.New("a\\#b\n\\#x c", NewlineState).Start()
+	testCases := []lexer.Token{
+		{Type: identifierTok, Value: "a#b"},
+		{Type: identifierTok, Value: "#x"},
+		{Type: identifierTok, Value: "c"},
+		{Type: eofTok, Value: ""},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.Value, func(t *testing.T) {
+			if got, expect := plain(*l.NextToken()), tC; got != expect {
+				t.Errorf("Expected [%v], but found [%v]", expect, got)
+			}
+		})
+	}
+}
+
+func TestReferenceSuffix(t *testing.T) {
+	testCases := []struct {
+		suffix string
+		src    string
+		expect []lexer.Token
+	}{
+		{"~", "line~+ title", []lexer.Token{
+			{Type: identifierTok, Value: "line"},
+			{Type: referenceTok, Value: "~"},
+			{Type: multiplicityTok, Value: "+"},
+			{Type: identifierTok, Value: "title"},
+			{Type: eofTok, Value: ""},
+		}},
+		{"*ref", "line*ref* bold*", []lexer.Token{
+			{Type: identifierTok, Value: "line"},
+			{Type: referenceTok, Value: "*ref"},
+			{Type: multiplicityTok, Value: "*"},
+			{Type: identifierTok, Value: "bold"},
+			{Type: multiplicityTok, Value: "*"},
+			{Type: eofTok, Value: ""},
+		}},
+		{"-ref", "my-line-ref+", []lexer.Token{
+			{Type: identifierTok, Value: "my-line"},
+			{Type: referenceTok, Value: "-ref"},
+			{Type: multiplicityTok, Value: "+"},
+			{Type: eofTok, Value: ""},
+		}},
+		{"~", "line...", []lexer.Token{
+			{Type: identifierTok, Value: "line"},
+			{Type: lexer.ErrorTok, Value: "Unexpected unicode character (U+002E '.') in outer context."},
+		}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			l := lexer.New(tC.src, OuterState)
+			l.State = &scanState{refSuffix: tC.suffix}
+			l.Start()
+			for _, expect := range tC.expect {
+				if got := plain(*l.NextToken()); got != expect {
+					t.Errorf("Expected [%v], but found [%v]", expect, got)
+				}
+			}
+		})
+	}
+}
+
+func TestIndentPolicy(t *testing.T) {
+	testCases := []struct {
+		policy IndentPolicy
+		src    string
+		expect lexer.Token
+	}{
+		{TabsOnly, "a\n\tb\n    c", lexer.Token{Type: lexer.ErrorTok, Value: "Indentation uses spaces but only tabs are allowed."}},
+		{SpacesOnly, "a\n    b\n\tc", lexer.Token{Type: lexer.ErrorTok, Value: "Indentation uses tabs but only spaces are allowed."}},
+		{Either, "a\n    b\n\tc", lexer.Token{Type: identifierTok, Value: "c"}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			l := lexer.New(tC.src, NewlineState)
+			l.State = &scanState{indentPolicy: tC.policy}
+			l.Start()
+			var last lexer.Token
+			for tok := l.NextToken(); tok != nil && tok.Type != eofTok && tok.Type != dedentTok; tok = l.NextToken() {
+				last = plain(*tok)
+			}
+			if last != tC.expect {
+				t.Errorf("Expected [%v], but found [%v]", tC.expect, last)
+			}
+		})
+	}
+}
+
+func TestMessageOverride(t *testing.T) {
+	l := lexer.New("name=\"open\n", OuterState)
+	l.State = &scanState{messages: Messages{RunawayQuote: "quote never closed after %q"}}
+	l.Start()
+	l.NextToken() // name
+	l.NextToken() // =
+	expect := lexer.Token{Type: lexer.ErrorTok, Value: `quote never closed after "open"`}
+	if got := plain(*l.NextToken()); got != expect {
+		t.Errorf("Expected [%v], but found [%v]", expect, got)
+	}
+}
+
+func TestMaxLexemeLength(t *testing.T) {
+	l := lexer.New(`short="12345" long="`+strings.Repeat("x", 100)+`"`, OuterState)
+	l.MaxLexemeLength = 5
+	l.Start()
+	testCases := []lexer.Token{
+		{Type: identifierTok, Value: "short"},
+		{Type: equalsTok, Value: "="},
+		{Type: quoteTok, Value: "12345"},
+		{Type: identifierTok, Value: "long"},
+		{Type: equalsTok, Value: "="},
+		{Type: lexer.ErrorTok, Value: "Lexeme exceeds the maximum length of 5 bytes."},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.Value, func(t *testing.T) {
-			if got, expect := l.NextToken(), tC; *got != expect {
+			if got, expect := plain(*l.NextToken()), tC; got != expect {
 				t.Errorf("Expected [%v], but found [%v]", expect, got)
 			}
 		})
 	}
+	if tok := l.NextToken(); tok != nil {
+		t.Errorf("Expected the scan to stop, but found [%v]", *tok)
+	}
+}
+
+func TestEndOfInput(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect lexer.Token
+	}{
+		{`a="open`, lexer.Token{Type: lexer.ErrorTok, Value: "Unexpected end of input inside quoted value: open"}},
+		{"a=\"open\nb", lexer.Token{Type: lexer.ErrorTok, Value: "Runaway quote: open"}},
+		{"a..", lexer.Token{Type: lexer.ErrorTok, Value: "Unexpected end of input inside reference ellipsis: .."}},
+		{"a.. b", lexer.Token{Type: lexer.ErrorTok, Value: "Malformed reference ellipsis: .."}},
+		{"a", lexer.Token{Type: eofTok, Value: ""}},
+		{"a\\", lexer.Token{Type: lexer.ErrorTok, Value: "Unexpected unicode character (U+005C '\\') in outer context."}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			l := lexer.New(tC.src, OuterState).Start()
+			var last lexer.Token
+			for tok := l.NextToken(); tok != nil; tok = l.NextToken() {
+				last = plain(*tok)
+			}
+			if last != tC.expect {
+				t.Errorf("Expected [%v], but found [%v]", tC.expect, last)
+			}
+		})
+	}
+}
+
+func TestIndentUnitChange(t *testing.T) {
+	l := lexer.New("a\n  b\nc\n    d\n", NewlineState)
+	l.State = &scanState{checkIndentUnit: true}
+	l.Start()
+	var warnings []string
+	for tok := l.NextToken(); tok != nil && tok.Type != eofTok; tok = l.NextToken() {
+		if tok.Type == lexer.WarningTok {
+			warnings = append(warnings, tok.Value)
+		}
+	}
+	expect := "Indent of 4 columns differs from the indent unit of 2 columns."
+	if len(warnings) != 1 || warnings[0] != expect {
+		t.Errorf("Expected [%s], but found %q", expect, warnings)
+	}
+}
+
+func TestBlankLinesWithWhitespace(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect []lexer.Token
+	}{
+		{"a\n  b\n   \t\nc\n", []lexer.Token{
+			{Type: identifierTok, Value: "a"},
+			{Type: indentTok, Value: "  "},
+			{Type: identifierTok, Value: "b"},
+			{Type: dedentTok, Value: ""},
+			{Type: identifierTok, Value: "c"},
+			{Type: eofTok, Value: ""},
+		}},
+		{"a\n  b\n    ", []lexer.Token{
+			{Type: identifierTok, Value: "a"},
+			{Type: indentTok, Value: "  "},
+			{Type: identifierTok, Value: "b"},
+			{Type: dedentTok, Value: ""},
+			{Type: eofTok, Value: ""},
+		}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			l := lexer.New(tC.src, NewlineState).Start()
+			for _, expect := range tC.expect {
+				if got := plain(*l.NextToken()); got != expect {
+					t.Errorf("Expected [%v], but found [%v]", expect, got)
+				}
+			}
+		})
+	}
+}
+
+func TestQuoteAtEnd(t *testing.T) {
+	l := lexer.New(`a="x"b='y'`, OuterState).Start()
+	expect := []lexer.Token{
+		{Type: identifierTok, Value: "a"},
+		{Type: equalsTok, Value: "="},
+		{Type: quoteTok, Value: "x"},
+		{Type: identifierTok, Value: "b"},
+		{Type: equalsTok, Value: "="},
+		{Type: quoteTok, Value: "y"},
+		{Type: eofTok, Value: ""},
+	}
+	for _, e := range expect {
+		if got := plain(*l.NextToken()); got != e {
+			t.Errorf("Expected [%v], but found [%v]", e, got)
+		}
+	}
+}
+
+// plain drops the position of tok so that it compares by type and value.
+func plain(tok lexer.Token) lexer.Token {
+	tok.Line, tok.Col, tok.EndLine, tok.EndCol = 0, 0, 0, 0
+	return tok
+}
+
+func TestQuoteEscapes(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect lexer.Token
+	}{
+		{`"he said \"hi\""`, lexer.Token{Type: quoteTok, Value: `he said "hi"`}},
+		{`'it\'s'`, lexer.Token{Type: quoteTok, Value: `it's`}},
+		{`"a\\b"`, lexer.Token{Type: quoteTok, Value: `a\b`}},
+		{`"c:\dir"`, lexer.Token{Type: quoteTok, Value: `c:\dir`}},
+		{`'say \"no\"'`, lexer.Token{Type: quoteTok, Value: `say \"no\"`}},
+		{`"open\"`, lexer.Token{Type: lexer.ErrorTok, Value: `Unexpected end of input inside quoted value: open\"`}},
+		{"\"open\\\"\n\"", lexer.Token{Type: lexer.ErrorTok, Value: `Runaway quote: open\"`}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			l := lexer.New(tC.src, OuterState).Start()
+			if got := plain(*l.NextToken()); got != tC.expect {
+				t.Errorf("Expected [%v], but found [%v]", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestTabWidth(t *testing.T) {
+	kinds := func(src string, tab int) string {
+		l := lexer.New(src, NewlineState)
+		l.TabWidth = tab
+		l.Start()
+		var result []string
+		for tok := l.NextToken(); tok != nil; tok = l.NextToken() {
+			result = append(result, tok.Type.String()+" "+strings.TrimSpace(tok.Value))
+		}
+		return strings.Join(result, ", ")
+	}
+	spaces := "a\n        b\n            c\n        d\ne"
+	tabs := "a\n\tb\n\t    c\n\td\ne"
+	if got, expect := kinds(tabs, 8), kinds(spaces, 8); got != expect {
+		t.Errorf("Expected tabs of width 8 to lex like 8 spaces:\n%s\nbut found:\n%s", expect, got)
+	}
+	if kinds(tabs, 0) != kinds(tabs, 4) {
+		t.Errorf("Expected the default tab width to be 4")
+	}
+	l := lexer.New("a\n\tb\n    c", NewlineState)
+	l.TabWidth = 8
+	l.Start()
+	var last lexer.Token
+	for tok := l.NextToken(); tok != nil; tok = l.NextToken() {
+		last = plain(*tok)
+	}
+	expect := lexer.Token{Type: lexer.ErrorTok, Value: "Inconsistent dedent. Expecting 0 but found 4."}
+	if last != expect {
+		t.Errorf("Expected [%v], but found [%v]", expect, last)
+	}
+}
+
+func TestArrow(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect []lexer.Token
+	}{
+		{"a=>b", []lexer.Token{
+			{Type: identifierTok, Value: "a"},
+			{Type: arrowTok, Value: "=>"},
+			{Type: identifierTok, Value: "b"},
+		}},
+		{"a= b", []lexer.Token{
+			{Type: identifierTok, Value: "a"},
+			{Type: equalsTok, Value: "="},
+			{Type: identifierTok, Value: "b"},
+		}},
+		{"a= >", []lexer.Token{
+			{Type: identifierTok, Value: "a"},
+			{Type: equalsTok, Value: "="},
+			{Type: lexer.ErrorTok, Value: "Unexpected unicode character (U+003E '>') in outer context."},
+		}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			l := lexer.New(tC.src, OuterState).Start()
+			for _, expect := range tC.expect {
+				if got := plain(*l.NextToken()); got != expect {
+					t.Errorf("Expected [%v], but found [%v]", expect, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEntity(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect []lexer.Token
+	}{
+		{"%inline = a", []lexer.Token{
+			{Type: entityTok, Value: "inline"},
+			{Type: equalsTok, Value: "="},
+			{Type: identifierTok, Value: "a"},
+		}},
+		{"(%inline;|b)", []lexer.Token{
+			{Type: openTok, Value: "("},
+			{Type: entityTok, Value: "inline"},
+			{Type: separatorTok, Value: "|"},
+			{Type: identifierTok, Value: "b"},
+		}},
+		{"% a", []lexer.Token{
+			{Type: lexer.ErrorTok, Value: "Unexpected unicode character (U+0025 '%') in outer context."},
+		}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			l := lexer.New(tC.src, OuterState).Start()
+			for _, expect := range tC.expect {
+				if got := plain(*l.NextToken()); got != expect {
+					t.Errorf("Expected [%v], but found [%v]", expect, got)
+				}
+			}
+		})
+	}
+}
+
+func TestNextTokenSync(t *testing.T) {
+	async := lexer.New(test1, NewlineState).Start()
+	sync := lexer.New(test1, NewlineState)
+	for {
+		want, got := async.NextToken(), sync.NextTokenSync()
+		if want == nil || got == nil {
+			if want != got {
+				t.Errorf("Expected %v, but found %v", want, got)
+			}
+			return
+		}
+		if *got != *want {
+			t.Errorf("Expected %v, but found %v", *want, *got)
+		}
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	for name, eol := range map[string]string{"CRLF": "\r\n", "CR": "\r"} {
+		t.Run(name, func(t *testing.T) {
+			want := lexer.New(test1, NewlineState)
+			got := lexer.New(strings.ReplaceAll(test1, "\n", eol), NewlineState)
+			for {
+				w, g := want.NextTokenSync(), got.NextTokenSync()
+				if w == nil || g == nil {
+					if w != g {
+						t.Errorf("Expected %v, but found %v", w, g)
+					}
+					return
+				}
+				if *g != *w {
+					t.Errorf("Expected %v, but found %v", *w, *g)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentifierPunctuation(t *testing.T) {
+	testCases := []struct {
+		src    string
+		expect []lexer.Token
+	}{
+		{"my-element", []lexer.Token{
+			{Type: identifierTok, Value: "my-element"},
+		}},
+		{"a.b.c", []lexer.Token{
+			{Type: identifierTok, Value: "a.b.c"},
+		}},
+		{"line...+", []lexer.Token{
+			{Type: identifierTok, Value: "line"},
+			{Type: referenceTok, Value: "..."},
+			{Type: multiplicityTok, Value: "+"},
+		}},
+		{"config.v2...", []lexer.Token{
+			{Type: identifierTok, Value: "config.v2"},
+			{Type: referenceTok, Value: "..."},
+		}},
+		{"-a", []lexer.Token{
+			{Type: lexer.ErrorTok, Value: "Unexpected unicode character (U+002D '-') in outer context."},
+		}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			l := lexer.New(tC.src, OuterState).Start()
+			for _, expect := range tC.expect {
+				if got := plain(*l.NextToken()); got != expect {
+					t.Errorf("Expected [%v], but found [%v]", expect, got)
+				}
+			}
+		})
+	}
 }
@@ -0,0 +1,22 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// GenerateSchematron writes a Schematron skeleton with one empty rule for
+// root and each element it reaches, ready for assertions to be added.
+func GenerateSchematron(root *Element, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	bw.WriteString(`<schema xmlns="http://purl.oclc.org/dsdl/schematron">` + "\n")
+	bw.WriteString("  <pattern>\n")
+	for _, e := range reachable(root) {
+		fmt.Fprintf(bw, "    <rule context=\"%s\">\n    </rule>\n", xmlEscape(e.Name))
+	}
+	bw.WriteString("  </pattern>\n")
+	bw.WriteString("</schema>\n")
+	return bw.Flush()
+}
@@ -0,0 +1,43 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSchematron(t *testing.T) {
+	src := "%inline = (bold | html:a)\n" +
+		"doc\n" +
+		"  section+\n" +
+		"    heading => (PCDATA | %inline)*\n" +
+		"    section...*\n" +
+		"  doc...?\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<schema xmlns="http://purl.oclc.org/dsdl/schematron">
+  <pattern>
+    <rule context="doc">
+    </rule>
+    <rule context="section">
+    </rule>
+    <rule context="heading">
+    </rule>
+    <rule context="bold">
+    </rule>
+    <rule context="html:a">
+    </rule>
+  </pattern>
+</schema>
+`
+	var buf bytes.Buffer
+	if err := GenerateSchematron(root, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
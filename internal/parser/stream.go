@@ -0,0 +1,27 @@
+package parser
+
+import "io"
+
+// Handler receives the definitions of a DTDX document as ParseStream reads
+// them, in input order.  StartElement and EndElement bracket each definition,
+// with the Attribute calls for its attributes and the definitions and
+// references of its content in between.  Reference names an element that
+// the content of from refers to as name..., or that a parameter entity does,
+// with from "".  An element defined with attributes first and its content
+// later is started and ended twice.
+type Handler interface {
+	StartElement(name string)
+	Attribute(element string, a Attribute)
+	EndElement(name string)
+	Reference(from, name string)
+}
+
+// ParseStream parses the DTDX document read from r as Parse does, reporting
+// its definitions to h as it reads them rather than returning a tree.  It
+// returns the first error, after the calls for the definitions before it.
+func ParseStream(r io.Reader, h Handler) error {
+	p := NewParser(r)
+	p.handler = h
+	_, err := p.Parse()
+	return err
+}
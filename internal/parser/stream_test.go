@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// recorder is a Handler that writes down each call.
+type recorder struct {
+	calls   []string
+	started []string
+}
+
+func (r *recorder) StartElement(name string) {
+	r.calls = append(r.calls, "<"+name)
+	r.started = append(r.started, name)
+}
+
+func (r *recorder) Attribute(element string, a Attribute) {
+	r.calls = append(r.calls, element+"@"+a.Name)
+}
+
+func (r *recorder) EndElement(name string) {
+	r.calls = append(r.calls, name+">")
+}
+
+func (r *recorder) Reference(from, name string) {
+	r.calls = append(r.calls, from+"->"+name)
+}
+
+func TestParseStream(t *testing.T) {
+	const src = test1 + "\nnote id= kind=\n  line...\n"
+	p := NewParser(strings.NewReader(src))
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	var r recorder
+	if err := ParseStream(strings.NewReader(src), &r); err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := strings.Join(r.started, " "), strings.Join(p.ElementNames(), " "); got != expect {
+		t.Errorf("Expected the elements %s, but found %s", expect, got)
+	}
+	expect := "<paragraph <title title> paragraph->line paragraph> " +
+		"<line <bold bold> line> " +
+		"<note note@id note@kind note->line note>"
+	if got := strings.Join(r.calls, " "); got != expect {
+		t.Errorf("Expected the calls %s, but found %s", expect, got)
+	}
+
+	r = recorder{}
+	if err := ParseStream(strings.NewReader("a\n  b\n  b\n"), &r); err == nil {
+		t.Errorf("Expected an error for a second definition of b")
+	}
+	if got, expect := strings.Join(r.calls, " "), "<a <b b>"; got != expect {
+		t.Errorf("Expected the calls %s before the error, but found %s", expect, got)
+	}
+}
@@ -0,0 +1,109 @@
+package parser
+
+// Report summarizes the shape of a document model.
+type Report struct {
+	Elements       int      // distinct elements reachable from the root
+	WithAttributes int      // elements that declare at least one attribute
+	References     int      // element particles in all content models
+	MaxDepth       int      // longest chain of nested elements, root included
+	Mixed          []string // elements whose content mixes #PCDATA and elements
+	Recursive      bool     // some element can contain itself
+}
+
+// Summary walks the elements reachable from root and reports counts and
+// facts about them, in definition order.
+func Summary(root *Element) Report {
+	r := Report{}
+	elems := reachable(root)
+	for _, e := range elems {
+		r.Elements++
+		if len(e.Attrs) > 0 {
+			r.WithAttributes++
+		}
+		r.References += len(e.Content.elements())
+		if e.Content.hasPCDATA() && len(e.Content.elements()) > 0 {
+			r.Mixed = append(r.Mixed, e.Name)
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[*Element]int{}
+	depth := map[*Element]int{}
+	var visit func(e *Element) int
+	visit = func(e *Element) int {
+		switch state[e] {
+		case visiting:
+			r.Recursive = true
+			return 0
+		case done:
+			return depth[e]
+		}
+		state[e] = visiting
+		deepest := 0
+		for _, child := range e.Content.elements() {
+			if d := visit(child); d > deepest {
+				deepest = d
+			}
+		}
+		state[e], depth[e] = done, deepest+1
+		return deepest + 1
+	}
+	if root != nil {
+		r.MaxDepth = visit(root)
+	}
+	return r
+}
+
+// reachable lists root and the elements its content reaches, each once, in
+// depth first definition order.
+func reachable(root *Element) []*Element {
+	var result []*Element
+	seen := map[*Element]bool{}
+	var visit func(e *Element)
+	visit = func(e *Element) {
+		if e == nil || seen[e] {
+			return
+		}
+		seen[e] = true
+		result = append(result, e)
+		for _, child := range e.Content.elements() {
+			visit(child)
+		}
+	}
+	visit(root)
+	return result
+}
+
+// elements lists the element particles of the content model in order.
+func (c *ContentModel) elements() []*Element {
+	if c == nil {
+		return nil
+	}
+	if c.modelType == elementModelType {
+		return []*Element{c.element}
+	}
+	var result []*Element
+	for _, child := range c.children {
+		result = append(result, child.elements()...)
+	}
+	return result
+}
+
+// hasPCDATA reports whether #PCDATA appears anywhere in the content model.
+func (c *ContentModel) hasPCDATA() bool {
+	if c == nil {
+		return false
+	}
+	if c.modelType == pcdataModelType {
+		return true
+	}
+	for _, child := range c.children {
+		if child.hasPCDATA() {
+			return true
+		}
+	}
+	return false
+}
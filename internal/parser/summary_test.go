@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+// docExample builds the paragraph/line model from the package doc.
+func docExample() *Element {
+	pcdata := ContentModel{modelType: pcdataModelType}
+	title := &Element{Name: "title", Content: pcdata}
+	bold := &Element{Name: "bold", Content: pcdata}
+	line := &Element{Name: "line", Content: ContentModel{
+		modelType:    sequenceModelType,
+		multiplicity: zeroOrMoreMultiplicity,
+		children: []*ContentModel{
+			{modelType: pcdataModelType},
+			{modelType: elementModelType, element: bold},
+		},
+	}}
+	return &Element{Name: "paragraph", Content: ContentModel{
+		modelType: sequenceModelType,
+		children: []*ContentModel{
+			{modelType: elementModelType, element: title, multiplicity: optionalMultiplicity},
+			{modelType: elementModelType, element: line, multiplicity: oneOrMoreMultiplicity},
+		},
+	}}
+}
+
+func TestSummary(t *testing.T) {
+	expect := Report{
+		Elements:   4,
+		References: 3,
+		MaxDepth:   3,
+		Mixed:      []string{"line"},
+	}
+	if got := Summary(docExample()); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected %+v, but found %+v", expect, got)
+	}
+}
+
+func TestSummaryRecursive(t *testing.T) {
+	root := docExample()
+	line := root.Content.children[1].element
+	line.Attrs = []Attribute{{Name: "id", Type: "ID"}}
+	line.Content.children = append(line.Content.children,
+		&ContentModel{modelType: elementModelType, element: line})
+
+	got := Summary(root)
+	if !got.Recursive {
+		t.Errorf("Expected line to make the model recursive")
+	}
+	if got.Elements != 4 || got.WithAttributes != 1 || got.References != 4 || got.MaxDepth != 3 {
+		t.Errorf("Unexpected counts %+v", got)
+	}
+}
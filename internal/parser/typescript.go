@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// tsAttrTypes maps DTD attribute types to TypeScript types.  Anything not
+// listed is a string; enumerations become unions of string literals.
+var tsAttrTypes = map[string]string{
+	"IDREFS":   "string[]",
+	"NMTOKENS": "string[]",
+	"ENTITIES": "string[]",
+}
+
+// GenerateTypeScript writes a TypeScript interface for root and for each
+// element it reaches that is not plain text.  Attributes are optional fields
+// unless #REQUIRED, and child elements follow their multiplicity: an array
+// when repeated, an optional field when they may be absent.
+func GenerateTypeScript(root *Element, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	first := true
+	for _, e := range reachable(root) {
+		if e != root && isTextOnly(e) {
+			continue
+		}
+		if !first {
+			bw.WriteString("\n")
+		}
+		first = false
+		fmt.Fprintf(bw, "export interface %s {\n", goName(e.Name))
+		for _, a := range e.Attrs {
+			tsField(bw, a.Name, tsAttrType(a.Type), a.Occur != required)
+		}
+		for _, c := range goChildren(&e.Content) {
+			typ := goName(c.element.Name)
+			if isTextOnly(c.element) {
+				typ = "string"
+			}
+			if c.repeated {
+				typ += "[]"
+			}
+			tsField(bw, c.element.Name, typ, c.optional)
+		}
+		if e.Content.modelType == unknownModelType || e.Content.hasPCDATA() {
+			tsField(bw, "text", "string", true)
+		}
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
+
+// tsField writes one interface member, quoting names like xml:lang that are
+// not TypeScript identifiers.
+func tsField(w io.Writer, name, typ string, optional bool) {
+	if strings.ContainsAny(name, ":-.") {
+		name = fmt.Sprintf("%q", name)
+	}
+	if optional {
+		name += "?"
+	}
+	fmt.Fprintf(w, "  %s: %s;\n", name, typ)
+}
+
+// tsAttrType returns the TypeScript type of a DTD attribute type.
+func tsAttrType(typ string) string {
+	typ = strings.TrimPrefix(typ, "#")
+	var values []string
+	switch {
+	case isNotation(typ):
+		values = notationValues(typ)
+	case isEnumeration(typ):
+		values = enumValues(typ)
+	default:
+		if ts, ok := tsAttrTypes[typ]; ok {
+			return ts
+		}
+		return "string"
+	}
+	for i, v := range values {
+		values[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(values, " | ")
+}
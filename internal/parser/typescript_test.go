@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTypeScript(t *testing.T) {
+	paragraph := &Element{
+		Name: "paragraph",
+		Attrs: []Attribute{
+			{Name: "id", Type: "ID", Occur: implied},
+			{Name: "name", Type: "CDATA", Occur: required},
+			{Name: "justify", Type: "(left|right|center)", Occur: implied},
+		},
+	}
+	expect := "export interface Paragraph {\n" +
+		"  id?: string;\n" +
+		"  name: string;\n" +
+		"  justify?: \"left\" | \"right\" | \"center\";\n" +
+		"  text?: string;\n" +
+		"}\n"
+	var buf bytes.Buffer
+	if err := GenerateTypeScript(paragraph, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestGenerateTypeScriptChildren(t *testing.T) {
+	src := "doc xml:lang=#NMTOKENS kind=(report|memo) #REQUIRED\n" +
+		"  title?\n" +
+		"  (note | figure...)\n" +
+		"  item+\n" +
+		"  section* id=\n" +
+		"    heading\n" +
+		"    section...?\n" +
+		"  para => (PCDATA | bold)*\n" +
+		"figure src= #REQUIRED #EMPTY\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "export interface Doc {\n" +
+		"  \"xml:lang\"?: string[];\n" +
+		"  kind: \"report\" | \"memo\";\n" +
+		"  title?: string;\n" +
+		"  note?: string;\n" +
+		"  figure?: Figure;\n" +
+		"  item: string[];\n" +
+		"  section?: Section[];\n" +
+		"  para: Para;\n" +
+		"}\n" +
+		"\n" +
+		"export interface Figure {\n" +
+		"  src: string;\n" +
+		"}\n" +
+		"\n" +
+		"export interface Section {\n" +
+		"  id?: string;\n" +
+		"  heading: string;\n" +
+		"  section?: Section;\n" +
+		"}\n" +
+		"\n" +
+		"export interface Para {\n" +
+		"  bold?: string[];\n" +
+		"  text?: string;\n" +
+		"}\n"
+	var buf bytes.Buffer
+	if err := GenerateTypeScript(root, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
@@ -0,0 +1,311 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteXSD writes an XML Schema with a global xs:element for root and for
+// every element it reaches, children referring to them with ref.  Content
+// that is only #PCDATA becomes type="xs:string", or a simple content
+// extension of it when the element has attributes.  Other content becomes an
+// xs:complexType, mixed when it holds #PCDATA, whose groups are xs:sequence,
+// xs:choice and xs:all with the multiplicity as minOccurs and maxOccurs.
+// EMPTY content has no particles and ANY content is a lax xs:any.  The
+// structured comments of an element, Docs, become its xs:annotation.
+//
+// XML Schema 1.0 allows in xs:all only elements that occur at most once, and
+// xs:all only as the whole content.  Any other & group becomes an xs:choice
+// repeated without bound, which accepts its members in any order but also
+// in any number.
+//
+// The schema has no target namespace, so elements and attributes are
+// declared by their local names, as html:body is by body, and two elements
+// with the same local name are an error.  Attributes with the xml prefix,
+// like xml:lang, refer to the declarations of the XML namespace, which the
+// schema imports, and xmlns attributes are namespace declarations that a
+// schema does not declare.
+func WriteXSD(w io.Writer, root *Element) error {
+	elements := reachable(root)
+	byLocal := map[string]*Element{}
+	xmlAttrs := false
+	for _, e := range elements {
+		if other := byLocal[e.Local()]; other != nil {
+			return fmt.Errorf("elements %s and %s have the same local name %s", other.Name, e.Name, e.Local())
+		}
+		byLocal[e.Local()] = e
+		for _, a := range e.Attrs {
+			xmlAttrs = xmlAttrs || a.Prefix() == "xml"
+		}
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	bw.WriteString(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">` + "\n")
+	if xmlAttrs {
+		bw.WriteString(`  <xs:import namespace="http://www.w3.org/XML/1998/namespace" schemaLocation="http://www.w3.org/2001/xml.xsd"/>` + "\n")
+	}
+	for _, e := range elements {
+		writeXSDElement(bw, e)
+	}
+	bw.WriteString("</xs:schema>\n")
+	return bw.Flush()
+}
+
+// writeXSDElement writes the global declaration of e.
+func writeXSDElement(w *bufio.Writer, e *Element) {
+	name := xmlEscape(e.Local())
+	text := isText(&e.Content)
+	if text && len(e.Attrs) == 0 {
+		if len(e.Docs) == 0 {
+			w.WriteString(`  <xs:element name="` + name + `" type="xs:string"/>` + "\n")
+			return
+		}
+		w.WriteString(`  <xs:element name="` + name + `" type="xs:string">` + "\n")
+		writeXSDAnnotation(w, e)
+		w.WriteString("  </xs:element>\n")
+		return
+	}
+	w.WriteString(`  <xs:element name="` + name + `">` + "\n")
+	writeXSDAnnotation(w, e)
+	switch {
+	case !e.Content.hasElements() && !e.Content.hasPCDATA() && e.Content.modelType != anyModelType && len(e.Attrs) == 0:
+		w.WriteString("    <xs:complexType/>\n")
+		w.WriteString("  </xs:element>\n")
+		return
+	case text:
+		w.WriteString("    <xs:complexType>\n")
+		w.WriteString("      <xs:simpleContent>\n")
+		w.WriteString(`        <xs:extension base="xs:string">` + "\n")
+		for _, a := range e.Attrs {
+			w.WriteString(xsdAttribute(a, "          "))
+		}
+		w.WriteString("        </xs:extension>\n")
+		w.WriteString("      </xs:simpleContent>\n")
+		w.WriteString("    </xs:complexType>\n")
+		w.WriteString("  </xs:element>\n")
+		return
+	case e.Content.modelType == anyModelType:
+		w.WriteString(`    <xs:complexType mixed="true">` + "\n")
+		w.WriteString("      <xs:sequence>\n")
+		w.WriteString(`        <xs:any minOccurs="0" maxOccurs="unbounded" processContents="lax"/>` + "\n")
+		w.WriteString("      </xs:sequence>\n")
+	case e.Content.hasPCDATA():
+		w.WriteString(`    <xs:complexType mixed="true">` + "\n")
+		writeXSDParticle(w, &e.Content, "      ", true)
+	default:
+		w.WriteString("    <xs:complexType>\n")
+		writeXSDParticle(w, &e.Content, "      ", true)
+	}
+	for _, a := range e.Attrs {
+		w.WriteString(xsdAttribute(a, "      "))
+	}
+	w.WriteString("    </xs:complexType>\n")
+	w.WriteString("  </xs:element>\n")
+}
+
+// writeXSDAnnotation writes the structured comments of e, if any, as an
+// xs:annotation with an xs:documentation for each key in order.  That of desc
+// is the plain description; the others name their key as the source.
+func writeXSDAnnotation(w *bufio.Writer, e *Element) {
+	if len(e.Docs) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(e.Docs))
+	for key := range e.Docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	w.WriteString("    <xs:annotation>\n")
+	for _, key := range keys {
+		source := ""
+		if key != "desc" {
+			source = ` source="` + xmlEscape(key) + `"`
+		}
+		w.WriteString("      <xs:documentation" + source + ">" + xmlEscape(e.Docs[key]) + "</xs:documentation>\n")
+	}
+	w.WriteString("    </xs:annotation>\n")
+}
+
+// isText reports whether the content model c holds only character data.
+func isText(c *ContentModel) bool {
+	switch c.modelType {
+	case unknownModelType, pcdataModelType:
+		return true
+	case groupModelType:
+		return len(c.children) == 1 && c.children[0].modelType == pcdataModelType
+	}
+	return false
+}
+
+// writeXSDParticle writes the content model fragment c at the given indent,
+// where top tells whether it is the whole content of its type.  #PCDATA is
+// left to the mixed attribute of the type, so a group of nothing else is
+// not written.
+func writeXSDParticle(w *bufio.Writer, c *ContentModel, indent string, top bool) {
+	if !c.hasElements() {
+		return
+	}
+	occurs := xsdOccurs(c.multiplicity)
+	switch c.modelType {
+	case elementModelType:
+		w.WriteString(indent + `<xs:element ref="` + xmlEscape(c.element.Local()) + `"` + occurs + "/>\n")
+		return
+	case entityModelType:
+		if occurs == "" {
+			writeXSDParticle(w, c.children[0], indent, top)
+			return
+		}
+	}
+	tag := xsdGroups[c.modelType]
+	if c.modelType == allModelType && !xsdAll(c, top) {
+		tag, occurs = "xs:choice", ` maxOccurs="unbounded"`
+		if c.multiplicity == optionalMultiplicity || c.multiplicity == zeroOrMoreMultiplicity {
+			occurs = ` minOccurs="0"` + occurs
+		}
+	}
+	w.WriteString(indent + "<" + tag + occurs + ">\n")
+	for _, child := range c.children {
+		writeXSDParticle(w, child, indent+"  ", false)
+	}
+	w.WriteString(indent + "</" + tag + ">\n")
+}
+
+// xsdAll reports whether the & group c can be an xs:all of XML Schema 1.0:
+// the whole content, where top is true, occurring at most once, of elements
+// that each occur at most once.
+func xsdAll(c *ContentModel, top bool) bool {
+	if !top || c.multiplicity != singleMultiplicity && c.multiplicity != optionalMultiplicity {
+		return false
+	}
+	for _, child := range c.children {
+		if child.modelType != elementModelType ||
+			child.multiplicity != singleMultiplicity && child.multiplicity != optionalMultiplicity {
+			return false
+		}
+	}
+	return true
+}
+
+// xsdGroups maps the group types of a content model to XML Schema groups.
+// A group of one and an entity with a multiplicity are sequences.
+var xsdGroups = map[modelType]string{
+	groupModelType:    "xs:sequence",
+	sequenceModelType: "xs:sequence",
+	choiceModelType:   "xs:choice",
+	allModelType:      "xs:all",
+	entityModelType:   "xs:sequence",
+}
+
+// hasElements reports whether an element appears anywhere in c.
+func (c *ContentModel) hasElements() bool {
+	return len(c.elements()) > 0
+}
+
+// xsdOccurs renders a multiplicity as the minOccurs and maxOccurs attributes
+// of a particle.
+func xsdOccurs(m multiplicity) string {
+	switch m {
+	case optionalMultiplicity:
+		return ` minOccurs="0"`
+	case zeroOrMoreMultiplicity:
+		return ` minOccurs="0" maxOccurs="unbounded"`
+	case oneOrMoreMultiplicity:
+		return ` maxOccurs="unbounded"`
+	}
+	return ""
+}
+
+// xsdTypes maps the atomic DTD attribute types to XML Schema datatypes.
+var xsdTypes = map[string]string{
+	"CDATA":    "xs:string",
+	"ID":       "xs:ID",
+	"IDREF":    "xs:IDREF",
+	"IDREFS":   "xs:IDREFS",
+	"NMTOKEN":  "xs:NMTOKEN",
+	"NMTOKENS": "xs:NMTOKENS",
+	"ENTITY":   "xs:ENTITY",
+	"ENTITIES": "xs:ENTITIES",
+	"NOTATION": "xs:NOTATION",
+}
+
+// AttributeGroupXSD renders the attributes of e as a named xs:attributeGroup.
+// Enumerated types become an inline xs:simpleType restriction of xs:NMTOKEN.
+func AttributeGroupXSD(e *Element, name string) string {
+	var result bytes.Buffer
+	result.WriteString(`<xs:attributeGroup name="` + xmlEscape(name) + `">` + "\n")
+	for _, a := range e.Attrs {
+		result.WriteString(xsdAttribute(a, "  "))
+	}
+	result.WriteString("</xs:attributeGroup>\n")
+	return result.String()
+}
+
+// xsdAttribute renders a as an xs:attribute at the given indent.  An
+// enumerated type becomes an inline xs:simpleType restriction of xs:NMTOKEN,
+// or of xs:NOTATION for a NOTATION type.  One with the xml prefix refers to
+// its declaration in the XML namespace, and an xmlns attribute is left out.
+func xsdAttribute(a Attribute, indent string) string {
+	switch {
+	case a.Name == "xmlns" || a.Prefix() == "xmlns":
+		return ""
+	case a.Prefix() == "xml":
+		return indent + `<xs:attribute ref="` + xmlEscape(a.Name) + `"` + xsdUse(a) + "/>\n"
+	}
+	var result bytes.Buffer
+	base, values := "", []string(nil)
+	switch {
+	case isNotation(a.Type):
+		base, values = "xs:NOTATION", notationValues(a.Type)
+	case isEnumeration(a.Type):
+		base, values = "xs:NMTOKEN", enumValues(a.Type)
+	}
+	result.WriteString(indent + `<xs:attribute name="` + xmlEscape(a.Local()) + `"`)
+	if base == "" {
+		result.WriteString(` type="` + xsdType(a.Type) + `"` + xsdUse(a) + "/>\n")
+		return result.String()
+	}
+	result.WriteString(xsdUse(a) + ">\n")
+	result.WriteString(indent + "  <xs:simpleType>\n")
+	result.WriteString(indent + `    <xs:restriction base="` + base + `">` + "\n")
+	for _, v := range values {
+		result.WriteString(indent + `      <xs:enumeration value="` + xmlEscape(v) + `"/>` + "\n")
+	}
+	result.WriteString(indent + "    </xs:restriction>\n")
+	result.WriteString(indent + "  </xs:simpleType>\n")
+	result.WriteString(indent + "</xs:attribute>\n")
+	return result.String()
+}
+
+// xsdType returns the XML Schema datatype of the atomic attribute type typ,
+// which may be written with its #, or xs:string for one it does not know.
+func xsdType(typ string) string {
+	if t, ok := xsdTypes[strings.TrimPrefix(typ, "#")]; ok {
+		return t
+	}
+	return "xs:string"
+}
+
+// xsdUse renders the use, fixed, and default attributes of an xs:attribute.
+func xsdUse(a Attribute) string {
+	switch a.Occur {
+	case required:
+		return ` use="required"`
+	case fixed:
+		return ` fixed="` + xmlEscape(a.Default) + `"`
+	}
+	if a.Default != "" {
+		return ` default="` + xmlEscape(a.Default) + `"`
+	}
+	return ` use="optional"`
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,304 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAttributeGroupXSD(t *testing.T) {
+	paragraph := &Element{
+		Name: "paragraph",
+		Attrs: []Attribute{
+			{Name: "id", Type: "ID", Occur: implied},
+			{Name: "name", Type: "CDATA", Occur: implied},
+			{Name: "justify", Type: "(left|right|center)", Occur: implied},
+		},
+	}
+	expect := `<xs:attributeGroup name="paragraphAttrs">
+  <xs:attribute name="id" type="xs:ID" use="optional"/>
+  <xs:attribute name="name" type="xs:string" use="optional"/>
+  <xs:attribute name="justify" use="optional">
+    <xs:simpleType>
+      <xs:restriction base="xs:NMTOKEN">
+        <xs:enumeration value="left"/>
+        <xs:enumeration value="right"/>
+        <xs:enumeration value="center"/>
+      </xs:restriction>
+    </xs:simpleType>
+  </xs:attribute>
+</xs:attributeGroup>
+`
+	if got := AttributeGroupXSD(paragraph, "paragraphAttrs"); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestAttributeGroupXSDUse(t *testing.T) {
+	testCases := []struct {
+		attr   Attribute
+		expect string
+	}{
+		{Attribute{Name: "a", Type: "CDATA", Occur: required}, ` use="required"`},
+		{Attribute{Name: "a", Type: "CDATA", Occur: fixed, Default: "x"}, ` fixed="x"`},
+		{Attribute{Name: "a", Type: "CDATA", Default: "<y>"}, ` default="&lt;y&gt;"`},
+		{Attribute{Name: "a", Type: "CDATA", Occur: implied}, ` use="optional"`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.expect, func(t *testing.T) {
+			if got := xsdUse(tC.attr); got != tC.expect {
+				t.Errorf("Expected [%s], but found [%s]", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestWriteXSD(t *testing.T) {
+	src := "doc id= kind=(a|b) #REQUIRED\n" +
+		"  title? lang=\"en\"\n" +
+		"  (para... | list...)+\n" +
+		"para => (PCDATA | bold)*\n" +
+		"list\n" +
+		"  item*\n" +
+		"  hr #EMPTY\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="doc">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element ref="title" minOccurs="0"/>
+        <xs:choice maxOccurs="unbounded">
+          <xs:element ref="para"/>
+          <xs:element ref="list"/>
+        </xs:choice>
+      </xs:sequence>
+      <xs:attribute name="id" type="xs:ID" use="optional"/>
+      <xs:attribute name="kind" use="required">
+        <xs:simpleType>
+          <xs:restriction base="xs:NMTOKEN">
+            <xs:enumeration value="a"/>
+            <xs:enumeration value="b"/>
+          </xs:restriction>
+        </xs:simpleType>
+      </xs:attribute>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="title">
+    <xs:complexType>
+      <xs:simpleContent>
+        <xs:extension base="xs:string">
+          <xs:attribute name="lang" type="xs:string" default="en"/>
+        </xs:extension>
+      </xs:simpleContent>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="para">
+    <xs:complexType mixed="true">
+      <xs:choice minOccurs="0" maxOccurs="unbounded">
+        <xs:element ref="bold"/>
+      </xs:choice>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="bold" type="xs:string"/>
+  <xs:element name="list">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element ref="item" minOccurs="0" maxOccurs="unbounded"/>
+        <xs:element ref="hr"/>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="item" type="xs:string"/>
+  <xs:element name="hr">
+    <xs:complexType/>
+  </xs:element>
+</xs:schema>
+`
+	var buf bytes.Buffer
+	if err := WriteXSD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+}
+
+func TestWriteXSDAnnotation(t *testing.T) {
+	src := "# @desc: The paragraph element\n" +
+		"# A plain comment.\n" +
+		"# @since: 1.2\n" +
+		"paragraph\n" +
+		"  # @desc: A <b> line\n" +
+		"  line*\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[string]string{"desc": "The paragraph element", "since": "1.2"}; len(root.Docs) != 2 ||
+		root.Docs["desc"] != expect["desc"] || root.Docs["since"] != expect["since"] {
+		t.Errorf("Expected docs %v, but found %v", expect, root.Docs)
+	}
+	if len(root.Doc) != 1 || root.Doc[0] != "A plain comment." {
+		t.Errorf("Expected the plain comment to stay, but found %q", root.Doc)
+	}
+	var buf bytes.Buffer
+	if err := WriteXSD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="paragraph">
+    <xs:annotation>
+      <xs:documentation>The paragraph element</xs:documentation>
+      <xs:documentation source="since">1.2</xs:documentation>
+    </xs:annotation>
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element ref="line" minOccurs="0" maxOccurs="unbounded"/>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="line" type="xs:string">
+    <xs:annotation>
+      <xs:documentation>A &lt;b&gt; line</xs:documentation>
+    </xs:annotation>
+  </xs:element>
+</xs:schema>
+`
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+	roundTrip(t, root)
+}
+
+func TestWriteXSDRoot(t *testing.T) {
+	root, err := NewParser(strings.NewReader("doc\n  part+\n    doc...?\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteXSD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if lines[2] != `  <xs:element name="doc">` {
+		t.Errorf("Expected the root to be the first global element, but found %s", lines[2])
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "  <xs:element ") && strings.Contains(line, "Occurs") {
+			t.Errorf("Expected a global element without occurrence, but found %s", line)
+		}
+	}
+	if !strings.Contains(buf.String(), `<xs:element ref="doc" minOccurs="0"/>`) {
+		t.Errorf("Expected the reference to the root to keep its multiplicity, but found:\n%s", buf.String())
+	}
+	if _, err := NewParser(strings.NewReader("doc+\n  part\n")).Parse(); err == nil {
+		t.Errorf("Expected a modifier on the root to be an error")
+	}
+}
+
+func TestWriteXSDAll(t *testing.T) {
+	testCases := []struct {
+		src, expect string
+	}{
+		{"doc => (a & b?)\n", `      <xs:all>
+        <xs:element ref="a"/>
+        <xs:element ref="b" minOccurs="0"/>
+      </xs:all>
+`},
+		{"doc => (a+ & b)\n", `      <xs:choice maxOccurs="unbounded">
+        <xs:element ref="a" maxOccurs="unbounded"/>
+        <xs:element ref="b"/>
+      </xs:choice>
+`},
+		{"doc => (a & b)*\n", `      <xs:choice minOccurs="0" maxOccurs="unbounded">
+        <xs:element ref="a"/>
+        <xs:element ref="b"/>
+      </xs:choice>
+`},
+		{"doc\n  title\n  (a & b)\n", `      <xs:sequence>
+        <xs:element ref="title"/>
+        <xs:choice maxOccurs="unbounded">
+          <xs:element ref="a"/>
+          <xs:element ref="b"/>
+        </xs:choice>
+      </xs:sequence>
+`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.src, func(t *testing.T) {
+			root, err := NewParser(strings.NewReader(tC.src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := WriteXSD(&buf, root); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); !strings.Contains(got, "    <xs:complexType>\n"+tC.expect+"    </xs:complexType>\n") {
+				t.Errorf("Expected the content:\n%s\nbut found:\n%s", tC.expect, got)
+			}
+		})
+	}
+}
+
+func TestWriteXSDNames(t *testing.T) {
+	src := "html:doc xml:lang= xmlns:x= x:id= #CDATA\n" +
+		"  html:p\n"
+	root, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:import namespace="http://www.w3.org/XML/1998/namespace" schemaLocation="http://www.w3.org/2001/xml.xsd"/>
+  <xs:element name="doc">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element ref="p"/>
+      </xs:sequence>
+      <xs:attribute ref="xml:lang" use="optional"/>
+      <xs:attribute name="id" type="xs:string" use="optional"/>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="p" type="xs:string"/>
+</xs:schema>
+`
+	var buf bytes.Buffer
+	if err := WriteXSD(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expect {
+		t.Errorf("Expected:\n%s\nbut found:\n%s", expect, got)
+	}
+
+	root, err = NewParser(strings.NewReader("doc\n  html:p\n  p\n")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectErr := "elements html:p and p have the same local name p"
+	if err := WriteXSD(&buf, root); err == nil || err.Error() != expectErr {
+		t.Errorf("Expected the error %q, but found %v", expectErr, err)
+	}
+}
+
+func TestXSDType(t *testing.T) {
+	testCases := []struct {
+		typ, expect string
+	}{
+		{"NMTOKEN", "xs:NMTOKEN"},
+		{"#NMTOKEN", "xs:NMTOKEN"},
+		{"#IDREF", "xs:IDREF"},
+		{"#CDATA", "xs:string"},
+		{"unknown", "xs:string"},
+	}
+	for _, tC := range testCases {
+		if got := xsdType(tC.typ); got != tC.expect {
+			t.Errorf("Expected %s for %s, but found %s", tC.expect, tC.typ, got)
+		}
+	}
+}